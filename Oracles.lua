@@ -209,4 +209,111 @@ end
 
 oracles_ram.itemcount = 1 -- dummy value, must be a positive integer
 
+-- relay mode: when this script is run directly from the BizHawk lua console
+-- instead of being loaded by bizhawk-co-op, it connects to a server started
+-- with `-devcmd multiserver`. see doc/multiworld.md.
+local relay_host = "localhost"
+local relay_port = 38281
+
+-- connects to the relay server, returning the socket or nil
+local function relay_connect(socket)
+	local conn = socket.tcp()
+	conn:settimeout(2)
+	local ok, err = conn:connect(relay_host, relay_port)
+	if not ok then
+		console.log(string.format("couldn't connect to %s:%d: %s",
+			relay_host, relay_port, err))
+		return nil
+	end
+
+	-- the server sends every item past the count we already have
+	conn:send(string.format("hello %d %s %d\n", this_player,
+		gameinfo.getromhash(), memory.readbyte(addrs.wNetCountIn)))
+	local line = conn:receive("*l")
+	if line ~= "ok" then
+		console.log(string.format("relay server: %s", line or "no response"))
+		conn:close()
+		return nil
+	end
+	conn:settimeout(0)
+	console.log(string.format("connected to %s:%d as P%d",
+		relay_host, relay_port, this_player))
+	return conn
+end
+
+-- main loop for relay mode
+local function run_relay()
+	local socket = require("socket")
+	local conn = nil
+	local pending = {} -- received items by index
+	local unsent = {} -- items found while disconnected
+	local retry_frame = 0
+
+	while true do
+		if conn == nil and emu.framecount() >= retry_frame then
+			conn = relay_connect(socket)
+			if conn ~= nil then
+				empty_queue(unsent, function(line) conn:send(line) end)
+			else
+				retry_frame = emu.framecount() + 300
+			end
+		end
+
+		-- read items from the server
+		while conn ~= nil do
+			local line, err = conn:receive("*l")
+			if line == nil then
+				if err == "closed" then
+					console.log("disconnected from relay server")
+					conn = nil
+				end
+				break
+			end
+			local index, from, room, id, param = string.match(line,
+				"^item (%d+) (%d+) (%x+) (%x+) (%x+)$")
+			if index ~= nil then
+				pending[tonumber(index)] = {
+					from = tonumber(from),
+					room = tonumber(room, 16),
+					id = tonumber(id, 16),
+					param = tonumber(param, 16),
+				}
+			end
+		end
+
+		if memory.readbyte(addrs.wGameState) == 2 then
+			-- give the next item to the game every frame until it's taken
+			local item = pending[memory.readbyte(addrs.wNetCountIn)]
+			if item ~= nil then
+				memory.writebyte(addrs.wNetTreasureIn, item.id)
+				memory.writebyte(addrs.wNetTreasureIn + 1, item.param)
+			end
+
+			-- send found items; the server knows who they belong to
+			if memory.readbyte(addrs.wNetPlayerOut) ~= 0 then
+				local line = string.format("send %04x %02x %02x\n",
+					memory.readbyte(addrs.wActiveGroup) * 0x100 +
+					memory.readbyte(addrs.wActiveRoom),
+					memory.readbyte(addrs.wNetTreasureOut),
+					memory.readbyte(addrs.wNetTreasureOut + 1))
+				memory.writebyte(addrs.wNetPlayerOut, 0)
+				memory.writebyte(addrs.wNetTreasureOut, 0)
+				memory.writebyte(addrs.wNetTreasureOut + 1, 0)
+				if conn ~= nil then
+					conn:send(line)
+				else
+					table.insert(unsent, line)
+				end
+			end
+		end
+
+		emu.frameadvance()
+	end
+end
+
+-- bizhawk-co-op loads this file with require, which passes the module name
+if select("#", ...) == 0 then
+	run_relay()
+end
+
 return oracles_ram
@@ -0,0 +1,278 @@
+package randomizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// batch mode generates many seeds from one vanilla ROM and a master seed, and
+// writes a manifest describing them. the output only depends on the master
+// seed, options, and version, regardless of how work is split among threads.
+
+// an entry in the batch manifest. seed and permalink are omitted in race mode.
+type batchSeed struct {
+	Seed      string `json:"seed,omitempty"`
+	Permalink string `json:"permalink,omitempty"`
+	Rom       string `json:"rom"`
+	Log       string `json:"log,omitempty"`
+	Sha1      string `json:"sha1"`
+	Attempts  int    `json:"attempts"`
+
+	// from seedMetrics
+	Spheres         int            `json:"spheres"`
+	Depth           int            `json:"depth"`
+	RequiredChecks  int            `json:"requiredChecks"`
+	DungeonChecks   int            `json:"dungeonChecks"`
+	OverworldChecks int            `json:"overworldChecks"`
+	ItemSpheres     map[string]int `json:"itemSpheres"`
+	HardTricks      []string       `json:"hardTricks,omitempty"`
+}
+
+type batchManifest struct {
+	Version    string       `json:"version"`
+	Game       string       `json:"game"`
+	MasterSeed string       `json:"masterSeed,omitempty"`
+	Seeds      []*batchSeed `json:"seeds"`
+}
+
+// how many times a batch or stats seed is rerolled when no route is found for
+// it, before giving up.
+const maxSeedRerolls = 10
+
+// returns n seeds derived from a master seed.
+func getBatchSeeds(master uint32, n int) []uint32 {
+	src := rand.New(rand.NewSource(int64(master)))
+	seeds := make([]uint32, n)
+	for i := range seeds {
+		seeds[i] = src.Uint32()
+	}
+	return seeds
+}
+
+// returns command-line flags that reproduce a seed with the given options.
+func getPermalink(seed uint32, ropts *randomizerOptions) string {
+	a := []string{fmt.Sprintf("-seed %08x", seed)}
+	for _, flag := range []struct {
+		set  bool
+		name string
+	}{
+		{ropts.hard, "-hard"},
+		{ropts.treewarp, "-treewarp"},
+		{ropts.dungeons, "-dungeons"},
+		{ropts.d6pair, "-d6pair"},
+		{ropts.portals, "-portals"},
+		{ropts.mixwarps, "-mixwarps"},
+		{ropts.decouple, "-decouple"},
+		{ropts.earlyflute, "-flute progression-early"},
+		{ropts.race, "-race"},
+		{ropts.icons, "-icons"},
+	} {
+		if flag.set {
+			a = append(a, flag.name)
+		}
+	}
+	if ropts.companion != 0 {
+		a = append(a, "-companion "+companionNames[ropts.companion])
+	}
+	if ropts.seasons != "" && ropts.seasons != "random" {
+		a = append(a, "-seasons "+ropts.seasons)
+	}
+	if len(ropts.seasonset) != 0 {
+		overrides := make([]string, 0, len(ropts.seasonset))
+		for _, area := range orderedKeys(ropts.seasonset) {
+			overrides = append(overrides,
+				fmt.Sprintf("%s:%s", area, ropts.seasonset[area]))
+		}
+		a = append(a, fmt.Sprintf("-setseasons %q",
+			strings.Join(overrides, ",")))
+	}
+	include := make([]string, 0, len(ropts.include))
+	for _, name := range ropts.include {
+		if name != "" {
+			include = append(include, name)
+		}
+	}
+	for _, flag := range []struct {
+		name, value string
+	}{
+		{"-include", strings.Join(include, ",")},
+		{"-hints", ropts.hintsPath},
+		{"-plando", ropts.plandoPath},
+	} {
+		if flag.value != "" {
+			a = append(a, fmt.Sprintf("%s %q", flag.name, flag.value))
+		}
+	}
+	return strings.Join(a, " ")
+}
+
+// generate count seeds from the ROM at romPath into outDir.
+func runBatch(romPath, outDir string, count int, ropts randomizerOptions,
+	logf logFunc) error {
+	b, game, err := readGivenRom(romPath)
+	if err != nil {
+		return err
+	}
+	if err := checkWarpOptions(game, &ropts); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+	master, err := setRandomSeed(ropts.seed)
+	if err != nil {
+		return err
+	}
+	if err := setNewRaceKey(
+		[]*randomizerOptions{&ropts}, logf); err != nil {
+		return err
+	}
+	seeds := getBatchSeeds(master, count)
+	logf("generating %d seeds in %s.", count, outDir)
+
+	// search for routes and write files
+	jobs := make(chan int)
+	results := make(chan *batchSeed)
+	errs := make(chan error)
+	for i := 0; i < runtime.NumCPU(); i++ {
+		go func() {
+			for i := range jobs {
+				entry, err := makeBatchSeed(b, game, i, count, seeds[i],
+					outDir, ropts)
+				if err != nil {
+					errs <- err
+				} else {
+					results <- entry
+				}
+			}
+		}()
+	}
+	go func() {
+		for i := range seeds {
+			jobs <- i
+		}
+		close(jobs)
+	}()
+
+	// receive results
+	manifest := batchManifest{
+		Version: version,
+		Game:    gameNames[game],
+		Seeds:   make([]*batchSeed, 0, count),
+	}
+	if !ropts.race {
+		manifest.MasterSeed = fmt.Sprintf("%08x", master)
+	}
+	// keep receiving after an error, so that the workers can finish.
+	var firstErr error
+	for i := 0; i < count; i++ {
+		select {
+		case entry := <-results:
+			manifest.Seeds = append(manifest.Seeds, entry)
+			logf("%d/%d: wrote %s", i+1, count, entry.Rom)
+		case err := <-errs:
+			// a ROM couldn't be written; don't write a manifest
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	sort.Slice(manifest.Seeds, func(i, j int) bool {
+		return manifest.Seeds[i].Rom < manifest.Seeds[j].Rom
+	})
+
+	// write manifest
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(outDir, "manifest.json")
+	if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	logf("wrote manifest to %s", path)
+
+	return nil
+}
+
+// generate and write the ith seed of a batch. if the given seed fails, seeds
+// are rerolled from it, so that the result is still deterministic.
+func makeBatchSeed(vanilla []byte, game, i, count int, seed uint32,
+	outDir string, ropts randomizerOptions) (*batchSeed, error) {
+	dummyLogf := func(string, ...interface{}) {}
+	reroll := rand.New(rand.NewSource(int64(seed)))
+
+	var rom *romState
+	var route *routeInfo
+	attempts := 0
+	for rerolls := 0; route == nil; rerolls++ {
+		rom = newRomState(append([]byte{}, vanilla...), game, 1, ropts.include)
+		rom.setTreewarp(ropts.treewarp)
+		var err error
+		route, err = findConstrainedRoute(rom, seed, ropts, false, dummyLogf)
+		if route == nil {
+			if rerolls == maxSeedRerolls {
+				return nil, fmt.Errorf("seed %d: %v (after %d rerolls)",
+					i+1, err, rerolls)
+			}
+			attempts += maxTries
+			seed = reroll.Uint32()
+		}
+	}
+	attempts += route.attemptCount
+	seed = route.seed
+	m := getRouteMetrics(route, game, rom.treasures)
+
+	// file names are prefixed with an index, since race mode names can
+	// collide
+	gamePrefix := sora(game, "oos", "ooa")
+	outfile := fmt.Sprintf("%0*d_%srando_%s_%s.gbc",
+		len(fmt.Sprint(count)), i+1, gamePrefix, version,
+		optString(seed, &ropts, "-"))
+	logFilename := strings.Replace(outfile, ".gbc", "", 1) + "_log.txt"
+
+	routes := []*routeInfo{route}
+	g, checks, spheres, extra := getAllSpheres(routes)
+	resetFunc := func() { route.graph.reset() }
+	sum, err := applyRoute(rom, route, outDir, logFilename, &ropts,
+		[]int{game}, checks, spheres, extra, g, resetFunc, rom.treasures,
+		false, dummyLogf)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(
+		filepath.Join(outDir, outfile), rom.data, 0644); err != nil {
+		return nil, err
+	}
+
+	entry := &batchSeed{
+		Rom:             outfile,
+		Sha1:            fmt.Sprintf("%x", sum),
+		Attempts:        attempts,
+		Spheres:         m.spheres,
+		Depth:           m.depth,
+		RequiredChecks:  m.requiredChecks,
+		DungeonChecks:   m.dungeonChecks,
+		OverworldChecks: m.overworldChecks,
+		ItemSpheres:     m.itemDepths,
+		HardTricks:      m.hardTricks,
+	}
+	if !ropts.race {
+		entry.Seed = fmt.Sprintf("%08x", seed)
+		entry.Permalink = getPermalink(seed, &ropts)
+		entry.Log = logFilename
+	} else if ropts.racekey != "" {
+		entry.Log = logFilename + ".sealed"
+	}
+	return entry, nil
+}
@@ -0,0 +1,34 @@
+package randomizer
+
+import (
+	"testing"
+)
+
+func TestBatchSeeds(t *testing.T) {
+	// same master seed, same seeds, regardless of count
+	seeds := getBatchSeeds(0x1234, 10)
+	testExpect(t, len(seeds), 10)
+	testExpect(t, getBatchSeeds(0x1234, 4), seeds[:4])
+	testExpect(t, getBatchSeeds(0x1235, 10)[0] != seeds[0], true)
+
+	testExpect(t, getPermalink(0xabc, &randomizerOptions{}), "-seed 00000abc")
+	testExpect(t, getPermalink(0xabc, &randomizerOptions{
+		hard:       true,
+		dungeons:   true,
+		companion:  moosh,
+		earlyflute: true,
+		seasons:    "chaos",
+		seasonset:  map[string]string{"sunken city": "winter"},
+	}), "-seed 00000abc -hard -dungeons -flute progression-early "+
+		"-companion moosh -seasons chaos -setseasons \"sunken city:winter\"")
+	testExpect(t, getPermalink(0xabc, &randomizerOptions{
+		race:      true,
+		icons:     true,
+		include:   []string{"a.yaml", "b.yaml"},
+		hintsPath: "hints.yaml",
+	}), "-seed 00000abc -race -icons -include \"a.yaml,b.yaml\" "+
+		"-hints \"hints.yaml\"")
+	testExpect(t, getPermalink(0xabc, &randomizerOptions{
+		include: []string{""},
+	}), "-seed 00000abc")
+}
@@ -416,6 +416,8 @@ func (rom *romState) initBanks() {
 		makeRoomTreasureTable(rom.game, rom.itemSlots))
 	rom.replaceRaw(address{0x3f, 0}, "owlTextOffsets",
 		string(make([]byte, numOwlIds*2)))
+	rom.replaceRaw(address{byte(sora(rom.game, 0x0a, 0x03).(int)), 0},
+		"startingItems", strings.Repeat("\xff", maxStartingItems*2+1))
 
 	// load all asm files in the asm/ directory.
 	dir, err := FS(false).Open("/asm/")
@@ -0,0 +1,223 @@
+package randomizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+)
+
+// implements -devcmd compare: generate seeds with the current logic and
+// compare their stats to a baseline from -devcmd stats, to see how a logic
+// change affects placement.
+
+// the chance of flagging any shift when nothing has changed. this is split
+// among all the tests that are run (a bonferroni correction), since a
+// comparison runs hundreds of them.
+const compareAlpha = 0.05
+
+// a difference between baseline and current stats.
+type statsShift struct {
+	desc string
+	z    float64
+}
+
+// the result of comparing stats.
+type statsComparison struct {
+	tests       int
+	threshold   float64 // |z| above which a shift is significant
+	shifts      []statsShift
+	unreachable []string // checks reachable in the baseline but not now
+}
+
+// loads stats written by -devcmd stats.
+func loadSeedStats(path string) (*seedStats, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := new(seedStats)
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if s.Seeds == 0 {
+		return nil, fmt.Errorf("%s: no seeds in stats", path)
+	}
+	return s, nil
+}
+
+// returns an error if baseline stats are for a different game or different
+// options than the current ones. baselines from before options were recorded
+// only get a warning.
+func checkBaseline(base *seedStats, game int, ropts randomizerOptions,
+	logf logFunc) error {
+	if base.Game != gameNames[game] {
+		return fmt.Errorf("baseline is for %s", base.Game)
+	}
+	if err := checkStatsOptions(game, &ropts); err != nil {
+		return err
+	}
+	opts := statsOptionString(&ropts)
+	switch base.Options {
+	case opts:
+	case "":
+		logf("warning: baseline doesn't record its options; "+
+			"make sure they match (%s).", opts)
+	default:
+		return fmt.Errorf("baseline options (%s) differ from current (%s)",
+			base.Options, opts)
+	}
+	return nil
+}
+
+// returns the z-score of the difference between two proportions, x1/n1 and
+// x2/n2, or 0 if it's undefined.
+func proportionZ(x1, n1, x2, n2 int) float64 {
+	if n1 == 0 || n2 == 0 {
+		return 0
+	}
+	p1, p2 := float64(x1)/float64(n1), float64(x2)/float64(n2)
+	p := float64(x1+x2) / float64(n1+n2)
+	se := math.Sqrt(p * (1 - p) * (1/float64(n1) + 1/float64(n2)))
+	if se == 0 {
+		return 0
+	}
+	return (p2 - p1) / se
+}
+
+// returns the count, mean, and sample variance of values in a histogram.
+func histogramMoments(h map[int]int) (int, float64, float64) {
+	n, sum := 0, 0.0
+	for v, count := range h {
+		n += count
+		sum += float64(v * count)
+	}
+	if n == 0 {
+		return 0, 0, 0
+	}
+	mean, ss := sum/float64(n), 0.0
+	for v, count := range h {
+		ss += float64(count) * math.Pow(float64(v)-mean, 2)
+	}
+	if n == 1 {
+		return n, mean, 0
+	}
+	return n, mean, ss / float64(n-1)
+}
+
+// returns the z-score of the difference between the means of two histograms,
+// or 0 if it's undefined. if neither histogram varies but the means differ,
+// the z-score is infinite.
+func meanZ(h1, h2 map[int]int) (float64, float64, float64) {
+	n1, m1, v1 := histogramMoments(h1)
+	n2, m2, v2 := histogramMoments(h2)
+	if n1 == 0 || n2 == 0 {
+		return m1, m2, 0
+	}
+	se := math.Sqrt(v1/float64(n1) + v2/float64(n2))
+	if se == 0 {
+		if m1 == m2 {
+			return m1, m2, 0
+		}
+		return m1, m2, math.Copysign(math.Inf(1), m2-m1)
+	}
+	return m1, m2, (m2 - m1) / se
+}
+
+// compares current stats to baseline stats.
+func compareStats(base, cur *seedStats) *statsComparison {
+	c := &statsComparison{}
+	all := make([]statsShift, 0)
+	test := func(z float64, format string, a ...interface{}) {
+		c.tests++
+		all = append(all, statsShift{desc: fmt.Sprintf(format, a...), z: z})
+	}
+
+	// item frequencies in each check
+	pairs := make(map[string]map[string]bool)
+	for _, m := range []map[string]map[string]int{base.SlotItems, cur.SlotItems} {
+		for slot, items := range m {
+			if pairs[slot] == nil {
+				pairs[slot] = make(map[string]bool)
+			}
+			for item := range items {
+				pairs[slot][item] = true
+			}
+		}
+	}
+	for _, slot := range orderedKeys(pairs) {
+		for _, item := range orderedKeys(pairs[slot]) {
+			x1, x2 := base.SlotItems[slot][item], cur.SlotItems[slot][item]
+			test(proportionZ(x1, base.Seeds, x2, cur.Seeds),
+				"%s in %s: %.1f%% -> %.1f%%", item, slot,
+				100*float64(x1)/float64(base.Seeds),
+				100*float64(x2)/float64(cur.Seeds))
+		}
+	}
+
+	// spheres of each item
+	items := make(map[string]bool)
+	for _, m := range []map[string]map[int]int{
+		base.ItemSpheres, cur.ItemSpheres} {
+		for item := range m {
+			items[item] = true
+		}
+	}
+	for _, item := range orderedKeys(items) {
+		m1, m2, z := meanZ(base.ItemSpheres[item], cur.ItemSpheres[item])
+		test(z, "%s mean sphere: %.2f -> %.2f", item, m1, m2)
+	}
+
+	// overall shape of seeds
+	m1, m2, z := meanZ(base.Spheres, cur.Spheres)
+	test(z, "mean spheres: %.2f -> %.2f", m1, m2)
+	m1, m2, z = meanZ(base.Depths, cur.Depths)
+	test(z, "mean depth: %.2f -> %.2f", m1, m2)
+	test(proportionZ(base.Attempts-base.Seeds, base.Attempts,
+		cur.Attempts-cur.Seeds, cur.Attempts),
+		"fill failure rate: %.1f%% -> %.1f%%",
+		100*base.FailureRate, 100*cur.FailureRate)
+
+	// flag shifts that are significant after correcting for the number of
+	// tests
+	c.threshold = math.Sqrt2 * math.Erfinv(1-compareAlpha/float64(c.tests))
+	for _, shift := range all {
+		if math.Abs(shift.z) > c.threshold {
+			c.shifts = append(c.shifts, shift)
+		}
+	}
+	sort.SliceStable(c.shifts, func(i, j int) bool {
+		return math.Abs(c.shifts[i].z) > math.Abs(c.shifts[j].z)
+	})
+
+	for _, slot := range orderedKeys(base.Reachable) {
+		if base.Reachable[slot] > 0 && cur.Reachable[slot] == 0 {
+			c.unreachable = append(c.unreachable, slot)
+		}
+	}
+
+	return c
+}
+
+// prints a comparison. returns false if anything changed significantly.
+func (c *statsComparison) log(base, cur *seedStats, logf logFunc) bool {
+	logf("compared %d seeds (version %s) to %d baseline seeds (version %s).",
+		cur.Seeds, cur.Version, base.Seeds, base.Version)
+	if len(c.shifts) == 0 {
+		logf("no significant shifts in %d tests.", c.tests)
+	} else {
+		logf("significant shifts (p < %g over %d tests, |z| > %.2f):",
+			compareAlpha, c.tests, c.threshold)
+		for _, shift := range c.shifts {
+			logf("  %s (z = %.2f)", shift.desc, shift.z)
+		}
+	}
+	if len(c.unreachable) > 0 {
+		logf("newly unreachable checks:")
+		for _, slot := range c.unreachable {
+			logf("  %s", slot)
+		}
+	}
+	return len(c.shifts) == 0 && len(c.unreachable) == 0
+}
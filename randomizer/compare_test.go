@@ -0,0 +1,60 @@
+package randomizer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCompareStats(t *testing.T) {
+	testExpect(t, proportionZ(0, 100, 0, 100), 0.0)
+	testExpect(t, proportionZ(50, 100, 50, 100), 0.0)
+	testExpect(t, proportionZ(10, 100, 50, 100) > 5, true)
+
+	n, mean, variance := histogramMoments(map[int]int{1: 1, 3: 1})
+	testExpect(t, n, 2)
+	testExpect(t, mean, 2.0)
+	testExpect(t, variance, 2.0)
+	_, _, z := meanZ(map[int]int{5: 10}, map[int]int{6: 10})
+	testExpect(t, math.IsInf(z, 1), true)
+
+	newStats := func(sword, feather int) *seedStats {
+		s := newSeedStats(gameSeasons, 0)
+		s.Seeds = 100
+		s.SlotItems["chest"] = map[string]int{"sword": sword,
+			"feather": 100 - sword}
+		s.ItemSpheres["feather"] = map[int]int{1: 50, 2: 50}
+		s.Spheres[10] = 100
+		s.Depths[8] = 100
+		s.Reachable["chest"] = 100
+		if feather > 0 {
+			s.Reachable["cliff"] = feather
+		}
+		s.setAttempts(200, 0)
+		return s
+	}
+	base := newStats(50, 100)
+
+	c := compareStats(base, newStats(48, 100))
+	testExpect(t, c.tests, 6)
+	testExpect(t, len(c.shifts), 0)
+	testExpect(t, len(c.unreachable), 0)
+
+	c = compareStats(base, newStats(95, 0))
+	testExpect(t, len(c.shifts), 2)
+	testExpect(t, c.unreachable, []string{"cliff"})
+
+	// baselines have to match the current game and options
+	warnings := 0
+	logf := func(string, ...interface{}) { warnings++ }
+	ropts := randomizerOptions{hard: true}
+	base.Options = statsOptionString(&ropts)
+	testExpect(t, base.Options, "h")
+	testExpect(t, checkBaseline(base, gameSeasons, ropts, logf), nil)
+	testExpect(t, checkBaseline(base, gameAges, ropts, logf) != nil, true)
+	testExpect(t, checkBaseline(base, gameSeasons, randomizerOptions{},
+		logf) != nil, true)
+	base.Options = ""
+	testExpect(t, checkBaseline(base, gameSeasons, ropts, logf), nil)
+	testExpect(t, warnings, 1)
+	testExpect(t, statsOptionString(&randomizerOptions{}), "none")
+}
@@ -1,6 +1,7 @@
 package randomizer
 
 import (
+	"regexp"
 	"strings"
 	"testing"
 
@@ -9,7 +10,7 @@ import (
 
 func TestLoadYaml(t *testing.T) {
 	// make sure all yaml files are well-formed.
-	dirnames := []string{"asm", "hints", "logic", "romdata"}
+	dirnames := []string{"asm", "hints", "logic", "presets", "romdata"}
 	for _, dirname := range dirnames {
 		// get list of files in directory
 		dir, err := FS(false).Open("/" + dirname + "/")
@@ -43,3 +44,70 @@ func TestLoadYaml(t *testing.T) {
 		}
 	}
 }
+
+func TestAsmLabels(t *testing.T) {
+	// make sure that everything called or jumped to by name is defined for
+	// the game that the code is assembled for.
+	dir, err := FS(false).Open("/asm/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := dir.Readdir(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	asmFiles := make([]*asmData, 0, len(files))
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ".yaml") {
+			data := new(asmData)
+			if err := yaml.Unmarshal(
+				FSMustByte(false, "/asm/"+file.Name()), data); err != nil {
+				t.Fatal(err)
+			}
+			asmFiles = append(asmFiles, data)
+		}
+	}
+
+	defineRegexp := regexp.MustCompile(`define\s+(\w+)`)
+	jumpRegexp := regexp.MustCompile(`\b(?:call|jp|jr)\s+([\w.,]+)`)
+	hexRegexp := regexp.MustCompile(`^[0-9a-f]+$`)
+	for _, game := range []int{gameSeasons, gameAges} {
+		floating := make(map[string]string)
+		for _, data := range asmFiles {
+			for _, item := range data.Floating {
+				floating[item.Key.(string)] = item.Value.(string)
+			}
+		}
+
+		defined := make(map[string]bool)
+		code := make(map[string]string)
+		for _, data := range asmFiles {
+			slice := sora(game, data.Seasons, data.Ages).(yaml.MapSlice)
+			for _, item := range append(data.Common, slice...) {
+				k, v := item.Key.(string), item.Value.(string)
+				if strings.HasPrefix(v, "/include") {
+					v = floating[strings.Split(v, " ")[1]]
+				}
+				if _, label := parseMetalabel(k); label != "" {
+					defined[label] = true
+				}
+				for _, match := range defineRegexp.FindAllStringSubmatch(v, -1) {
+					defined[match[1]] = true
+				}
+				code[k] = v
+			}
+		}
+
+		for k, v := range code {
+			for _, match := range jumpRegexp.FindAllStringSubmatch(v, -1) {
+				a := strings.Split(match[1], ",")
+				target := a[len(a)-1]
+				if !strings.HasPrefix(target, ".") &&
+					!hexRegexp.MatchString(target) && !defined[target] {
+					t.Errorf("%s %s: undefined label %s",
+						gameNames[game], k, target)
+				}
+			}
+		}
+	}
+}
@@ -73,10 +73,12 @@ type routeInfo struct {
 	seasons      map[string]byte
 	entrances    map[string]string
 	portals      map[string]string
-	companion    int // 1 to 3
+	portalExits  map[string]string // subrosia -> holodrum
+	companion    int               // 1 to 3
 	usedItems    *list.List
 	usedSlots    *list.List
 	ringMap      map[string]string
+	startItems   []string // extra items given at the start, from -plando
 	attemptCount int
 	src          *rand.Rand
 }
@@ -87,6 +89,9 @@ const (
 	moosh   = 3
 )
 
+// indexed by companion ID.
+var companionNames = []string{"random", "ricky", "dimitri", "moosh"}
+
 func newRouteGraph(rom *romState) graph {
 	g := newGraph()
 	totalPrenodes := getPrenodes(rom.game)
@@ -111,6 +116,23 @@ func findRoute(rom *romState, seed uint32, src *rand.Rand,
 		usedSlots: list.New(),
 		src:       src,
 	}
+	normalizeWarpOptions(&ropts)
+
+	var rp *resolvedPlando
+	var planRings []string
+	if ropts.plando != nil {
+		var err error
+		if rp, err = ropts.plando.resolve(rom); err != nil {
+			return nil, err
+		}
+		ri.startItems, planRings = rp.start, rp.rings
+		if rp.companion != 0 {
+			if ropts.companion != 0 && ropts.companion != rp.companion {
+				return nil, fmt.Errorf("companion doesn't match flute")
+			}
+			ropts.companion = rp.companion
+		}
+	}
 
 	// try to find the route, retrying if needed
 	tries := 0
@@ -124,8 +146,13 @@ func findRoute(rom *romState, seed uint32, src *rand.Rand,
 			ri.graph["hard"].addParent(ri.graph["start"])
 		}
 
-		ri.companion = rollAnimalCompanion(ri.src, ri.graph, rom.game)
-		ri.ringMap, _ = rom.randomizeRingPool(ri.src, nil)
+		ri.companion = rollAnimalCompanion(
+			ri.src, ri.graph, rom.game, ropts.companion)
+		var err error
+		if ri.ringMap, err = rom.randomizeRingPool(
+			ri.src, planRings); err != nil {
+			return nil, err
+		}
 		itemList, slotList = initRouteInfo(ri, rom)
 
 		// attach free items to the "start" node until placed.
@@ -136,14 +163,35 @@ func findRoute(rom *romState, seed uint32, src *rand.Rand,
 
 		// slot "world" nodes before items
 		if rom.game == gameSeasons {
-			ri.seasons = rollSeasons(ri.src, ri.graph)
-			ri.portals = setPortals(ri.src, ri.graph, ropts.portals)
+			ri.seasons = rollSeasons(
+				ri.src, ri.graph, ropts.seasons, ropts.seasonset)
+			if ropts.mixwarps {
+				ri.entrances = setMixedWarps(ri.src, ri.graph, ropts)
+			} else {
+				ri.portals, ri.portalExits = setPortals(
+					ri.src, ri.graph, ropts.portals, ropts.decouple)
+			}
+		}
+		if !ropts.mixwarps || rom.game != gameSeasons {
+			ri.entrances = setDungeonEntrances(
+				ri.src, ri.graph, rom.game, ropts)
+		}
+
+		if rp != nil {
+			if err := rp.linkStartItems(ri.graph); err != nil {
+				return nil, err
+			}
+			if err := rp.placeItems(ri, itemList, slotList); err != nil {
+				return nil, err
+			}
 		}
-		ri.entrances = setDungeonEntrances(
-			ri.src, ri.graph, rom.game, ropts.dungeons)
 
-		if tryPlaceItems(
-			ri, itemList, slotList, rom.treasures, rom.game, verbose, logf) {
+		if ropts.earlyflute {
+			placeFluteEarly(ri, itemList, slotList, rp)
+		}
+
+		if tryPlaceItems(ri, itemList, slotList, rom.treasures, rom.game,
+			rp, verbose, logf) {
 			ri.graph.reset()
 			ri.graph["start"].explore()
 			if ri.graph["done"].reached {
@@ -173,60 +221,139 @@ var (
 		"holodrum plain", "sunken city", "lost woods", "tarm ruins",
 		"western coast", "temple remains",
 	}
+	seasonModes = []string{"random", "vanilla", "weighted", "chaos"}
 )
 
+// default seasons in the vanilla game, as in asm/vars.yaml.
+var vanillaSeasons = map[string]string{
+	"north horon":     "winter",
+	"eastern suburbs": "autumn",
+	"woods of winter": "summer",
+	"spool swamp":     "autumn",
+	"holodrum plain":  "spring",
+	"sunken city":     "summer",
+	"lost woods":      "autumn",
+	"tarm ruins":      "spring",
+	"western coast":   "winter",
+	"temple remains":  "winter",
+}
+
 // set the default seasons for all the applicable areas in the game, and return
-// a mapping of area name to season value.
-func rollSeasons(src *rand.Rand, g graph) map[string]byte {
+// a mapping of area name to season value. in weighted mode, each area's
+// vanilla season is as likely as the other three combined; in chaos mode, no
+// area has its vanilla season. overrides take precedence over the mode.
+func rollSeasons(src *rand.Rand, g graph, mode string,
+	overrides map[string]string) map[string]byte {
 	seasonMap := make(map[string]byte, len(seasonAreas))
 	for _, area := range seasonAreas {
-		id := src.Intn(len(seasonsById))
-		season := seasonsById[id]
-		g[fmt.Sprintf("%s default %s", area, season)].addParent(g["start"])
+		vanillaId := getStringIndex(seasonsById, vanillaSeasons[area])
+		var id int
+		switch mode {
+		case "vanilla":
+			id = vanillaId
+		case "weighted":
+			if src.Intn(2) == 0 {
+				id = vanillaId
+			} else {
+				id = (vanillaId + 1 + src.Intn(3)) % len(seasonsById)
+			}
+		case "chaos":
+			id = (vanillaId + 1 + src.Intn(3)) % len(seasonsById)
+		default:
+			id = src.Intn(len(seasonsById))
+		}
+		if season, ok := overrides[area]; ok {
+			id = getStringIndex(seasonsById, season)
+		}
+
 		seasonMap[area] = byte(id)
 	}
+	linkSeasons(g, seasonMap)
 	return seasonMap
 }
 
-// connect dungeon entrances, randomly or vanilla-ly.
-func setDungeonEntrances(
-	src *rand.Rand, g graph, game int, shuffle bool) map[string]string {
-	dungeonEntranceMap := make(map[string]string)
+// connects the default season nodes for a map of area name to season value.
+func linkSeasons(g graph, seasonMap map[string]byte) {
+	for area, id := range seasonMap {
+		season := seasonsById[id]
+		g[fmt.Sprintf("%s default %s", area, season)].addParent(g["start"])
+	}
+}
+
+// returns the names of dungeons whose entrances can be shuffled. hero's cave
+// never is, and the d2 alt entrances only exist in vanilla.
+func getShuffledDungeons(g graph, game int, ropts randomizerOptions) []string {
 	dungeons := make([]string, len(dungeonNames[game]))
 	copy(dungeons, dungeonNames[game])
 	if game == gameSeasons {
+		if !ropts.dungeons {
+			g["d2 alt entrances enabled"].addParent(g["start"])
+		}
 		dungeons = dungeons[1:]
 	}
+	return dungeons
+}
 
-	if game == gameSeasons && !shuffle {
-		g["d2 alt entrances enabled"].addParent(g["start"])
-	}
+// connect dungeon entrances, randomly or vanilla-ly.
+func setDungeonEntrances(src *rand.Rand, g graph, game int,
+	ropts randomizerOptions) map[string]string {
+	dungeonEntranceMap := make(map[string]string)
+	dungeons := getShuffledDungeons(g, game, ropts)
 
 	entrances := make([]string, len(dungeons))
 	copy(entrances, dungeons)
 
-	if shuffle {
+	if ropts.dungeons {
 		src.Shuffle(len(entrances), func(i, j int) {
 			entrances[i], entrances[j] = entrances[j], entrances[i]
 		})
+
+		// put the two d6 entrances back together, possibly swapped.
+		if game == gameAges && ropts.d6pair {
+			i := getStringIndex(entrances, "d6 present")
+			j := getStringIndex(dungeons, "d6 present")
+			entrances[i], entrances[j] = entrances[j], entrances[i]
+			i = getStringIndex(entrances, "d6 past")
+			j = getStringIndex(dungeons, "d6 past")
+			entrances[i], entrances[j] = entrances[j], entrances[i]
+			if src.Intn(2) == 0 {
+				i = getStringIndex(dungeons, "d6 present")
+				entrances[i], entrances[j] = entrances[j], entrances[i]
+			}
+		}
 	}
 
 	for i := 0; i < len(dungeons); i++ {
-		entranceName := fmt.Sprintf("%s entrance", entrances[i])
 		dungeonEntranceMap[entrances[i]] = dungeons[i]
-		g[fmt.Sprintf("enter %s", dungeons[i])].addParent(g[entranceName])
 	}
+	linkDungeonEntrances(g, dungeonEntranceMap)
 
 	return dungeonEntranceMap
 }
 
-// connect subrosia portals, randomly or vanilla-ly.
-func setPortals(src *rand.Rand, g graph, shuffle bool) map[string]string {
-	portalMap := make(map[string]string)
-	var portals = []string{
-		"eastern suburbs", "spool swamp", "mt. cucco", "eyeglass lake",
-		"horon village", "temple remains lower", "temple remains upper",
+// connects dungeon entrances to the dungeons they lead to.
+func linkDungeonEntrances(g graph, entrances map[string]string) {
+	for entrance, dungeon := range entrances {
+		g[fmt.Sprintf("enter %s", dungeon)].
+			addParent(g[fmt.Sprintf("%s entrance", entrance)])
 	}
+}
+
+// holodrum portal names, in vanilla order.
+var holodrumPortalNames = []string{
+	"eastern suburbs", "spool swamp", "mt. cucco", "eyeglass lake",
+	"horon village", "temple remains lower", "temple remains upper",
+}
+
+// connect subrosia portals, randomly or vanilla-ly. returns a map of holodrum
+// portals to the subrosia portals they lead to, and a map of subrosia portals
+// to the holodrum portals they lead to. if not decoupled, the maps are
+// inverses of each other.
+func setPortals(src *rand.Rand, g graph,
+	shuffle, decouple bool) (map[string]string, map[string]string) {
+	portalMap := make(map[string]string)
+	exitMap := make(map[string]string)
+	portals := holodrumPortalNames
 	var connects = make([]string, len(portals))
 	for i, portal := range portals {
 		connects[i] = subrosianPortalNames[portal]
@@ -240,19 +367,123 @@ func setPortals(src *rand.Rand, g graph, shuffle bool) map[string]string {
 
 	for i := 0; i < len(portals); i++ {
 		portalMap[portals[i]] = connects[i]
-		g[fmt.Sprintf("exit %s portal", connects[i])].
-			addParent(g[fmt.Sprintf("enter %s portal", portals[i])])
-		g[fmt.Sprintf("exit %s portal", portals[i])].
-			addParent(g[fmt.Sprintf("enter %s portal", connects[i])])
+		exitMap[connects[i]] = portals[i]
 	}
 
-	return portalMap
+	if shuffle && decouple {
+		returns := make([]string, len(portals))
+		copy(returns, portals)
+		src.Shuffle(len(returns), func(i, j int) {
+			returns[i], returns[j] = returns[j], returns[i]
+		})
+		for i, portal := range portals {
+			exitMap[subrosianPortalNames[portal]] = returns[i]
+		}
+	}
+
+	linkPortals(g, portalMap, exitMap)
+	return portalMap, exitMap
+}
+
+// connects portals in both directions, given maps like those returned by
+// setPortals.
+func linkPortals(g graph, portalMap, exitMap map[string]string) {
+	for in, out := range portalMap {
+		g[fmt.Sprintf("exit %s portal", out)].
+			addParent(g[fmt.Sprintf("enter %s portal", in)])
+	}
+	for in, out := range exitMap {
+		g[fmt.Sprintf("exit %s portal", out)].
+			addParent(g[fmt.Sprintf("enter %s portal", in)])
+	}
+}
+
+// returns true iff the portal and exit maps aren't inverses of each other.
+func portalsDecoupled(portalMap, exitMap map[string]string) bool {
+	for in, out := range portalMap {
+		if exitMap[out] != in {
+			return true
+		}
+	}
+	return false
+}
+
+// connect dungeon entrances and holodrum portals as a single pool (seasons
+// only). keys and values of the returned map are warp names: "d1" etc. for
+// dungeons and "<holodrum name> portal" for portals. a key means walking into
+// that entrance, and a value means arriving where that warp normally leads.
+func setMixedWarps(src *rand.Rand, g graph,
+	ropts randomizerOptions) map[string]string {
+	warpMap := make(map[string]string)
+	names := getShuffledDungeons(g, gameSeasons, ropts)
+	for _, portal := range holodrumPortalNames {
+		names = append(names, portal+" portal")
+	}
+
+	dests := make([]string, len(names))
+	copy(dests, names)
+	src.Shuffle(len(dests), func(i, j int) {
+		dests[i], dests[j] = dests[j], dests[i]
+	})
+
+	for i, entrance := range names {
+		warpMap[entrance] = dests[i]
+		linkMixedWarp(g, entrance, dests[i])
+	}
+
+	return warpMap
+}
+
+// returns true iff the entrance map is from a mixed dungeon/portal pool.
+func warpsMixed(entrances map[string]string) bool {
+	for k, v := range entrances {
+		if strings.HasSuffix(k, " portal") || strings.HasSuffix(v, " portal") {
+			return true
+		}
+	}
+	return false
+}
+
+// adds graph connections for one entrance/destination pair in a mixed pool.
+// walking back out of a destination leads out of the entrance, but arriving
+// outside a dungeon entrance doesn't have its own logic node, so only portal
+// entrances get a link in that direction.
+func linkMixedWarp(g graph, entrance, dest string) {
+	var in, out, back *node
+	if dungeonNameRegexp.MatchString(entrance) {
+		in = g[entrance+" entrance"]
+	} else {
+		in = g["enter "+entrance]
+		back = g["exit "+entrance]
+	}
+	if dungeonNameRegexp.MatchString(dest) {
+		out = g["enter "+dest]
+		if back != nil {
+			back.addParent(out)
+		}
+	} else {
+		subrosian := subrosianPortalNames[strings.TrimSuffix(dest, " portal")]
+		out = g[fmt.Sprintf("exit %s portal", subrosian)]
+		if back != nil {
+			back.addParent(g[fmt.Sprintf("enter %s portal", subrosian)])
+		}
+	}
+	out.addParent(in)
 }
 
-// randomly determines animal companion and returns its ID (1 to 3)
-func rollAnimalCompanion(src *rand.Rand, g graph, game int) int {
+// randomly determines animal companion and returns its ID (1 to 3), unless a
+// companion is forced.
+func rollAnimalCompanion(src *rand.Rand, g graph, game, forced int) int {
 	companion := src.Intn(3) + 1
+	if forced != 0 {
+		companion = forced
+	}
+	linkAnimalCompanion(g, game, companion)
+	return companion
+}
 
+// connects the region logic node for the given companion.
+func linkAnimalCompanion(g graph, game, companion int) {
 	if game == gameSeasons {
 		switch companion {
 		case ricky:
@@ -272,8 +503,53 @@ func rollAnimalCompanion(src *rand.Rand, g graph, game int) int {
 			g["moosh nuun"].addParent(g["start"])
 		}
 	}
+}
 
-	return companion
+// places the flute in a random slot that's reachable without any other items
+// from the pool, so that the companion is available early. if there is no such
+// slot, the flute is left in the pool.
+func placeFluteEarly(ri *routeInfo, itemList, slotList *list.List,
+	rp *resolvedPlando) {
+	var eFlute *list.Element
+	for ei := itemList.Front(); ei != nil; ei = ei.Next() {
+		if strings.HasSuffix(ei.Value.(*node).name, " flute") {
+			eFlute = ei
+			break
+		}
+	}
+	if eFlute == nil {
+		return
+	}
+	flute := eFlute.Value.(*node)
+
+	for ei := itemList.Front(); ei != nil; ei = ei.Next() {
+		ei.Value.(*node).removeParent(ri.graph["start"])
+	}
+	ri.graph.reset()
+	ri.graph["start"].explore()
+
+	candidates := make([]*list.Element, 0)
+	for es := slotList.Front(); es != nil; es = es.Next() {
+		slot := es.Value.(*node)
+		if slot.reached && itemFitsInSlot(flute, slot) &&
+			rp.allows(flute.name, slot.name) {
+			candidates = append(candidates, es)
+		}
+	}
+
+	for ei := itemList.Front(); ei != nil; ei = ei.Next() {
+		if ei != eFlute || len(candidates) == 0 {
+			ei.Value.(*node).addParent(ri.graph["start"])
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	es := candidates[ri.src.Intn(len(candidates))]
+	flute.addParent(es.Value.(*node))
+	ri.usedItems.PushBack(itemList.Remove(eFlute))
+	ri.usedSlots.PushBack(slotList.Remove(es))
 }
 
 var seedNames = []string{"ember tree seeds", "scent tree seeds",
@@ -375,7 +651,8 @@ func initRouteInfo(
 
 // returns true iff successful
 func tryPlaceItems(ri *routeInfo, itemList, slotList *list.List,
-	treasures map[string]*treasure, game int, verbose bool, logf logFunc) bool {
+	treasures map[string]*treasure, game int, rp *resolvedPlando,
+	verbose bool, logf logFunc) bool {
 	for itemList.Len() > 0 && slotList.Len() > 0 {
 		if verbose {
 			logf("searching; filling %d more slots", slotList.Len())
@@ -383,7 +660,7 @@ func tryPlaceItems(ri *routeInfo, itemList, slotList *list.List,
 		}
 
 		eItem, eSlot := trySlotRandomItem(
-			ri.graph, ri.src, itemList, slotList, treasures, game)
+			ri.graph, ri.src, itemList, slotList, treasures, game, rp)
 
 		if eItem != nil {
 			item := itemList.Remove(eItem).(*node)
@@ -411,7 +688,8 @@ func tryPlaceItems(ri *routeInfo, itemList, slotList *list.List,
 }
 
 func trySlotRandomItem(g graph, src *rand.Rand, itemPool, slotPool *list.List,
-	treasures map[string]*treasure, game int) (usedItem, usedSlot *list.Element) {
+	treasures map[string]*treasure, game int,
+	rp *resolvedPlando) (usedItem, usedSlot *list.Element) {
 	// try placing the first item in a slot until it fits
 	triedProgression := false
 	for _, progressionItemsOnly := range []bool{true, false} {
@@ -431,7 +709,8 @@ func trySlotRandomItem(g graph, src *rand.Rand, itemPool, slotPool *list.List,
 			for es := slotPool.Front(); es != nil; es = es.Next() {
 				slot := es.Value.(*node)
 
-				if !itemFitsInSlot(item, slot) {
+				if !itemFitsInSlot(item, slot) ||
+					!rp.allows(item.name, slot.name) {
 					continue
 				}
 
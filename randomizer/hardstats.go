@@ -108,32 +108,11 @@ func getHardStats(routes []*routeInfo) map[string]int {
 	hardReqs := make(map[string]int)
 
 	for _, r := range routes {
-		// create a "null" node that is never true
-		hard := r.graph["hard"]
-		null := newNode("null", orNode)
-		r.graph["null"] = null
-		r.graph["start"].explore()
-
-		anything := false // track if any hard trick was required
-
-		for k, v := range r.graph {
-			if v.reached && hasParent(v, hard) {
-				v.addParent(null)
-				r.graph.reset()
-				r.graph["start"].explore()
-
-				if !r.graph["done"].reached {
-					hardReqs[k]++
-					anything = true
-				}
-
-				v.removeParent(null)
-				r.graph.reset()
-				r.graph["start"].explore()
-			}
+		required := getRequiredHardNodes(r)
+		for _, k := range required {
+			hardReqs[k]++
 		}
-
-		if anything {
+		if len(required) > 0 {
 			hardReqs["anything"]++
 		}
 	}
@@ -141,6 +120,39 @@ func getHardStats(routes []*routeInfo) map[string]int {
 	return hardReqs
 }
 
+// returns the sorted names of hard-logic nodes that a route can't be completed
+// without.
+func getRequiredHardNodes(r *routeInfo) []string {
+	required := make([]string, 0)
+
+	// create a "null" node that is never true
+	hard := r.graph["hard"]
+	null := newNode("null", orNode)
+	r.graph["null"] = null
+	defer delete(r.graph, "null")
+	r.graph.reset()
+	r.graph["start"].explore()
+
+	for k, v := range r.graph {
+		if v.reached && hasParent(v, hard) {
+			v.addParent(null)
+			r.graph.reset()
+			r.graph["start"].explore()
+
+			if !r.graph["done"].reached {
+				required = append(required, k)
+			}
+
+			v.removeParent(null)
+			r.graph.reset()
+			r.graph["start"].explore()
+		}
+	}
+
+	sort.Strings(required)
+	return required
+}
+
 // print required hard tricks in descending order of frequency.
 func printOrderedHardStats(w io.Writer, counts map[string]int,
 	trials int, nameMap map[string]string) {
@@ -160,10 +172,19 @@ func printOrderedHardStats(w io.Writer, counts map[string]int,
 
 // generate a bunch of seeds and print info about frequency of required hard
 // logic tricks.
-func logHardStats(game, trials int, ropts randomizerOptions, logf logFunc) {
+func logHardStats(game, trials int, master uint32,
+	ropts randomizerOptions) error {
+	if err := checkStatsOptions(game, &ropts); err != nil {
+		return err
+	}
+
 	// get `trials` routes
-	routes := generateSeeds(trials, game, ropts)
+	routes, _, _, err := generateSeeds(trials, game, master, ropts)
+	if err != nil {
+		return err
+	}
 	nameMap := ternary(game == gameSeasons,
 		seasonsTrickNames, agesTrickNames).(map[string]string)
 	printOrderedHardStats(os.Stdout, getHardStats(routes), trials, nameMap)
+	return nil
 }
@@ -47,6 +47,70 @@ func (rom *romState) setOwlData(owlHints map[string]string) {
 type hinter struct {
 	areas map[string]string
 	items map[string]string
+
+	// multiworld only
+	player  int
+	names   []string        // player names, by player number - 1
+	hinters map[int]*hinter // player number -> hinter for their game
+}
+
+// sets up a hinter to give hints about other players' games. games and names
+// are indexed by player number - 1.
+func (h *hinter) setMultiworld(player int, games []int, names []string) {
+	h.player = player
+	h.names = names
+	h.hinters = make(map[int]*hinter)
+	byGame := make(map[int]*hinter)
+	for i, game := range games {
+		if byGame[game] == nil {
+			byGame[game] = newHinter(game)
+		}
+		h.hinters[i+1] = byGame[game]
+	}
+}
+
+// returns true iff the slot or item node belongs to the hinter's player.
+func (h *hinter) isOwn(n *node) bool {
+	return n.player == 0 || n.player == h.player
+}
+
+// returns the area name of a slot as used in hints. in multiworld, this
+// includes whose game the area is in.
+func (h *hinter) slotArea(slot *node) string {
+	if h.names == nil {
+		return h.areas[slot.name]
+	}
+	if h.isOwn(slot) {
+		return "your " + h.areas[slot.name]
+	}
+	return fmt.Sprintf("%s's %s",
+		h.names[slot.player-1], h.hinters[slot.player].areas[slot.name])
+}
+
+// returns the name of an item as used in hints. in multiworld, other
+// players' items aren't named.
+func (h *hinter) itemName(item *node) string {
+	if h.names == nil {
+		return h.items[item.name]
+	}
+	if h.isOwn(item) {
+		name := h.items[item.name]
+		for _, article := range []string{"a ", "an ", "the "} {
+			name = strings.TrimPrefix(name, article)
+		}
+		return "your " + name
+	}
+	return "something for " + h.names[item.player-1]
+}
+
+// returns an error if a multiworld player name can't be used in hints. names
+// need to fit on one line of a text box with "'s" after them.
+func checkPlayerName(name string) error {
+	if len(name) == 0 || len(name) > 13 || strings.Contains(name, " ") ||
+		!isValidGameText(name) {
+		return fmt.Errorf("invalid player name: %q", name)
+	}
+	return nil
 }
 
 // returns a new hinter initialized for the given game.
@@ -87,57 +151,319 @@ func newHinter(game int) *hinter {
 	return h
 }
 
-// returns a randomly generated map of owl names to owl messages.
-func (h *hinter) generate(src *rand.Rand, g graph, checks map[*node]*node,
-	owlNames []string) map[string]string {
-	// function body starts here lol
+// the types of hints that can be given in a hint distribution.
+var hintTypes = []string{
+	"always", "woth", "barren", "item", "location", "owners"}
+
+// a hint distribution, as in hints/distribution.yaml.
+type hintDistribution struct {
+	Types  yaml.MapSlice       // type -> number of owls, in order
+	Always map[string][]string // game -> slot names
+	Items  map[string][]string // game -> item names
+}
+
+// loads and checks a hint distribution.
+func loadHintDistribution(b []byte) (*hintDistribution, error) {
+	dist := new(hintDistribution)
+	if err := yaml.UnmarshalStrict(b, dist); err != nil {
+		return nil, err
+	}
+	for _, item := range dist.Types {
+		name, ok := item.Key.(string)
+		if !ok || getStringIndex(hintTypes, name) == -1 {
+			return nil, fmt.Errorf("unknown hint type: %v", item.Key)
+		}
+		if n, ok := item.Value.(int); !ok || n < 0 {
+			return nil, fmt.Errorf("invalid number of %s hints: %v",
+				name, item.Value)
+		}
+	}
+	for game := range dist.Always {
+		if _, ok := reverseLookup(gameNames, game); !ok {
+			return nil, fmt.Errorf("unknown game in always hints: %s", game)
+		}
+	}
+	for game := range dist.Items {
+		if _, ok := reverseLookup(gameNames, game); !ok {
+			return nil, fmt.Errorf("unknown game in item hints: %s", game)
+		}
+	}
+	return dist, nil
+}
+
+// returns the default hint distribution.
+func defaultHintDistribution() *hintDistribution {
+	dist, err := loadHintDistribution(
+		FSMustByte(false, "/hints/distribution.yaml"))
+	if err != nil {
+		panic(err)
+	}
+	return dist
+}
+
+// returns one hint type per owl, in order, with "location" for any owls that
+// the distribution doesn't cover.
+func (dist *hintDistribution) owlTypes(n int) []string {
+	types := make([]string, 0, n)
+	for _, item := range dist.Types {
+		for i := 0; i < item.Value.(int) && len(types) < n; i++ {
+			types = append(types, item.Key.(string))
+		}
+	}
+	for len(types) < n {
+		types = append(types, "location")
+	}
+	return types
+}
+
+// state for generating one seed's hints.
+type hintState struct {
+	h           *hinter
+	g           graph
+	resetFunc   func()
+	checks      map[*node]*node
+	hintedSlots map[*node]bool
+	hintedAreas map[string]bool
+
+	// shuffled candidates for each type
+	always, woth, items, locations []*node
+	barren                         []string
+
+	// multiworld: slots in other games that hold the player's major items and
+	// jewels
+	essentials   []*node
+	ownersHinted bool
+}
+
+// returns a randomly generated map of owl names to owl messages. owls maps
+// owl names to their nodes, which should be reachable from g["start"].
+// checks should only contain slots in the player's own world.
+func (h *hinter) generate(src *rand.Rand, g graph, resetFunc func(),
+	checks map[*node]*node, owls map[string]*node, game int,
+	treasures map[string]*treasure,
+	dist *hintDistribution) (map[string]string, error) {
+	hs := &hintState{
+		h:           h,
+		g:           g,
+		resetFunc:   resetFunc,
+		checks:      checks,
+		hintedSlots: make(map[*node]bool),
+		hintedAreas: make(map[string]bool),
+		locations:   getShuffledHintSlots(src, checks),
+	}
+
+	// sort out candidates. slot/item names in the distribution need to exist,
+	// but don't need to be in this seed's checks.
+	slotsByName := make(map[string]*node)
+	for slot := range checks {
+		if h.isOwn(slot) {
+			slotsByName[slot.name] = slot
+		}
+	}
+	for _, name := range dist.Always[gameNames[game]] {
+		if _, ok := h.areas[name]; !ok {
+			return nil, fmt.Errorf("unknown check in always hints: %s", name)
+		}
+		if slot := slotsByName[name]; slot != nil {
+			hs.always = append(hs.always, slot)
+		}
+	}
+	majorItems := make(map[string]bool)
+	for _, name := range dist.Items[gameNames[game]] {
+		if _, ok := h.items[name]; !ok {
+			return nil, fmt.Errorf("unknown item in item hints: %s", name)
+		}
+		majorItems[name] = true
+	}
+	for _, slot := range hs.locations {
+		if item := checks[slot]; majorItems[item.name] && h.isOwn(item) {
+			hs.items = append(hs.items, slot)
+		}
+	}
+
+	// an area with a required key isn't barren, but keys alone don't make
+	// an area worth a way of the hero hint. dungeons aren't either, since
+	// their essences are always required.
+	required, _ := filterJunk(g, checks, treasures, resetFunc)
+	prog := make(map[*node]*node)
+	for slot, item := range required {
+		if !keyRegexp.MatchString(item.name) &&
+			getDungeonName(slot.name) == "" {
+			prog[slot] = item
+		}
+	}
+	hs.woth = sortedHintSlots(prog)
+	hs.barren = h.getBarrenAreas(checks, required)
+	if h.names != nil {
+		for _, slot := range sortedHintSlots(checks) {
+			item := checks[slot]
+			if !h.isOwn(slot) && h.isOwn(item) && (majorItems[item.name] ||
+				strings.HasSuffix(item.name, " jewel")) {
+				hs.essentials = append(hs.essentials, slot)
+			}
+		}
+	}
+	src.Shuffle(len(hs.always), func(i, j int) {
+		hs.always[i], hs.always[j] = hs.always[j], hs.always[i]
+	})
+	src.Shuffle(len(hs.woth), func(i, j int) {
+		hs.woth[i], hs.woth[j] = hs.woth[j], hs.woth[i]
+	})
+	src.Shuffle(len(hs.barren), func(i, j int) {
+		hs.barren[i], hs.barren[j] = hs.barren[j], hs.barren[i]
+	})
+
+	// give each owl a type, in random order
+	owlNames := orderedKeys(owls)
+	src.Shuffle(len(owlNames), func(i, j int) {
+		owlNames[i], owlNames[j] = owlNames[j], owlNames[i]
+	})
 	hints := make(map[string]string)
-	slots := getShuffledHintSlots(src, checks)
-	i := 0
-
-	// keep track of which slots have been hinted at in order to avoid
-	// duplicates. in practice the implementation of the hint loop makes this
-	// very unlikely in the first place.
-	hintedSlots := make(map[*node]bool)
-
-	for _, owlName := range owlNames {
-		// sometimes owls are just unreachable, so anything goes, i guess
-		g.reset()
-		g["start"].explore()
-		owlUnreachable := !g[owlName].reached
-
-		// if we're in plando mode, there could be no slots.
-		if len(slots) == 0 || len(hintedSlots) >= len(slots) {
-			hints[owlName] = h.format("...")
-			continue
+	for i, hintType := range dist.owlTypes(len(owlNames)) {
+		owlName := owlNames[i]
+		hint := hs.next(hintType, owls[owlName])
+		if hint == "" && hintType != "location" {
+			hint = hs.next("location", owls[owlName])
+		}
+		if hint == "" {
+			// if we're in plando mode, there could be no slots.
+			hint = "..."
 		}
+		hints[owlName] = h.format(strings.ToUpper(hint[:1]) + hint[1:])
+	}
 
-		for {
-			slot, item := slots[i], checks[slots[i]]
-			i = (i + 1) % len(slots)
+	hs.resetFunc()
+	g.reset()
 
-			if hintedSlots[slot] {
+	return hints, nil
+}
+
+// returns the next hint of a type for an owl, or "" if there are no more
+// hints of that type.
+func (hs *hintState) next(hintType string, owl *node) string {
+	// sometimes owls are just unreachable, so anything goes, i guess
+	hs.explore()
+	owlUnreachable := !owl.reached
+
+	switch hintType {
+	case "always", "item", "location":
+		candidates := map[string][]*node{
+			"always":   hs.always,
+			"item":     hs.items,
+			"location": hs.locations,
+		}[hintType]
+		for _, slot := range candidates {
+			if hs.hintedSlots[slot] ||
+				(!owlUnreachable && hs.isRequiredForOwl(slot, owl)) {
 				continue
 			}
+			hs.hintedSlots[slot] = true
+			return fmt.Sprintf("%s holds %s.",
+				hs.h.slotArea(slot), hs.h.itemName(hs.checks[slot]))
+		}
+	case "woth":
+		for _, slot := range hs.woth {
+			area := hs.h.slotArea(slot)
+			if hs.hintedAreas[area] ||
+				(!owlUnreachable && hs.isRequiredForOwl(slot, owl)) {
+				continue
+			}
+			hs.hintedAreas[area] = true
+			return fmt.Sprintf("%s is on the way of the hero.", area)
+		}
+	case "barren":
+		for _, area := range hs.barren {
+			if hs.h.names != nil {
+				area = "your " + area
+			}
+			if hs.hintedAreas[area] {
+				continue
+			}
+			hs.hintedAreas[area] = true
+			return fmt.Sprintf("%s is foolish.", area)
+		}
+	case "owners":
+		if !hs.ownersHinted && len(hs.essentials) > 0 {
+			hs.ownersHinted = true
+			return hs.h.ownersHint(hs.essentials, hs.checks)
+		}
+	}
+
+	return ""
+}
 
-			// don't give hints about checks that are required to reach the owl
-			// in the first place, as dictated by the logic of the seed.
-			item.removeParent(slot)
-			g.reset()
-			g["start"].explore()
-			required := !g[owlName].reached
-			item.addParent(slot)
-
-			if !required || owlUnreachable {
-				hints[owlName] = h.format(fmt.Sprintf("%s holds %s.",
-					h.areas[slot.name], h.items[item.name]))
-				hintedSlots[slot] = true
-				break
+// returns a hint naming the areas in other players' games that hold the
+// player's items in the given slots, like "Zelda's Spool Swamp has your Sword
+// and your Roc's Feather." areas are given in player order.
+func (h *hinter) ownersHint(slots []*node, checks map[*node]*node) string {
+	areas := make([]string, 0, len(slots))
+	byArea := make(map[string][]string)
+	for player := 1; player <= len(h.names); player++ {
+		for _, slot := range slots {
+			if slot.player != player {
+				continue
+			}
+			area, name := h.slotArea(slot), h.itemName(checks[slot])
+			if _, ok := byArea[area]; !ok {
+				areas = append(areas, area)
+			}
+			if getStringIndex(byArea[area], name) == -1 {
+				byArea[area] = append(byArea[area], name)
 			}
 		}
 	}
 
-	return hints
+	sentences := make([]string, 0, len(areas))
+	for _, area := range areas {
+		names := byArea[area]
+		list := names[len(names)-1]
+		if len(names) > 1 {
+			list = strings.Join(names[:len(names)-1], ", ") + " and " + list
+		}
+		sentences = append(sentences, fmt.Sprintf("%s has %s.", area, list))
+	}
+	return strings.Join(sentences, " ")
+}
+
+func (hs *hintState) explore() {
+	hs.resetFunc()
+	hs.g.reset()
+	hs.g["start"].explore()
+}
+
+// don't give hints about checks that are required to reach the owl in the
+// first place, as dictated by the logic of the seed.
+func (hs *hintState) isRequiredForOwl(slot, owl *node) bool {
+	item := hs.checks[slot]
+	item.removeParent(slot)
+	hs.explore()
+	required := !owl.reached
+	item.addParent(slot)
+	return required
+}
+
+// returns the sorted names of the player's overworld areas that have checks,
+// none of which are in prog.
+func (h *hinter) getBarrenAreas(checks, prog map[*node]*node) []string {
+	barren := make(map[string]bool)
+	for slot := range checks {
+		if area := h.areas[slot.name]; area != "" && h.isOwn(slot) &&
+			getDungeonName(slot.name) == "" {
+			if _, ok := barren[area]; !ok {
+				barren[area] = true
+			}
+			if prog[slot] != nil {
+				barren[area] = false
+			}
+		}
+	}
+	areas := make([]string, 0, len(barren))
+	for _, area := range orderedKeys(barren) {
+		if barren[area] {
+			areas = append(areas, area)
+		}
+	}
+	return areas
 }
 
 // formats a string for a text box. this doesn't include control characters.
@@ -179,6 +505,16 @@ func (ns nodeSlice) Swap(i, j int) {
 	ns[i], ns[j] = ns[j], ns[i]
 }
 
+// returns the slots of a check map, sorted by name.
+func sortedHintSlots(checks map[*node]*node) []*node {
+	slots := make([]*node, 0, len(checks))
+	for slot := range checks {
+		slots = append(slots, slot)
+	}
+	sort.Sort(nodeSlice(slots))
+	return slots
+}
+
 // getShuffledHintSlots returns a randomly ordered slice of slot nodes.
 func getShuffledHintSlots(src *rand.Rand, checks map[*node]*node) []*node {
 	// make slice of check names
@@ -1,6 +1,7 @@
 package randomizer
 
 import (
+	"math/rand"
 	"strings"
 	"testing"
 )
@@ -54,3 +55,181 @@ func TestDanglingHints(t *testing.T) {
 		}
 	}
 }
+
+func TestHintDistribution(t *testing.T) {
+	defaultHintDistribution() // panics if invalid
+
+	for _, bad := range []string{
+		"types: {woth: 1, sometimes: 1}",
+		"types: {woth: -1}",
+		"always: {oracle of secrets: [maku tree]}",
+		"tyeps: {woth: 1}",
+	} {
+		_, err := loadHintDistribution([]byte(bad))
+		testExpect(t, err != nil, true)
+	}
+
+	dist, err := loadHintDistribution([]byte("types: {woth: 2, barren: 1}"))
+	testExpect(t, err, nil)
+	testExpect(t, dist.owlTypes(4),
+		[]string{"woth", "woth", "barren", "location"})
+	testExpect(t, dist.owlTypes(1), []string{"woth"})
+}
+
+func TestGenerateHints(t *testing.T) {
+	// the sword is in the field, the feather is on the cliff, a required key
+	// is in the cave, the bracelet is in a dungeon, and there's junk in the
+	// woods. one owl needs the sword.
+	g := newGraph()
+	for _, name := range []string{"start", "field chest", "cliff chest",
+		"woods chest", "cave chest", "d1 chest", "owl 1", "owl 2", "owl 3",
+		"done"} {
+		g[name] = newNode(name, andNode)
+	}
+	for _, name := range []string{
+		"sword", "feather", "junk", "small key", "bracelet"} {
+		g[name] = newNode(name, orNode)
+	}
+	g.addParents(map[string][]string{
+		"field chest": {"start"},
+		"cliff chest": {"sword"},
+		"woods chest": {"start"},
+		"cave chest":  {"start"},
+		"d1 chest":    {"start"},
+		"owl 1":       {"sword"},
+		"owl 2":       {"start"},
+		"owl 3":       {"start"},
+		"done":        {"feather", "small key", "bracelet"},
+	})
+	checks := make(map[*node]*node)
+	for slot, item := range map[string]string{
+		"field chest": "sword",
+		"cliff chest": "feather",
+		"woods chest": "junk",
+		"cave chest":  "small key",
+		"d1 chest":    "bracelet",
+	} {
+		g[item].addParent(g[slot])
+		checks[g[slot]] = g[item]
+	}
+	h := &hinter{
+		areas: map[string]string{
+			"field chest": "Field",
+			"cliff chest": "Cliff",
+			"woods chest": "Woods",
+			"cave chest":  "Cave",
+			"d1 chest":    "Dungeon",
+		},
+		items: map[string]string{
+			"sword":     "a Sword",
+			"feather":   "Roc's Feather",
+			"junk":      "Junk",
+			"small key": "a Small Key",
+			"bracelet":  "the Bracelet",
+		},
+	}
+	treasures := map[string]*treasure{
+		"sword":     {id: 0x05},
+		"feather":   {id: 0x17},
+		"junk":      {id: 0x29},
+		"small key": {id: 0x30},
+		"bracelet":  {id: 0x16},
+	}
+	owls := map[string]*node{
+		"owl 1": g["owl 1"], "owl 2": g["owl 2"], "owl 3": g["owl 3"]}
+	dist, err := loadHintDistribution([]byte(
+		"types: {woth: 2, barren: 2}\nitems: {seasons: [feather]}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for seed := int64(0); seed < 10; seed++ {
+		src := rand.New(rand.NewSource(seed))
+		hints, err := h.generate(src, g, func() {}, checks, owls,
+			gameSeasons, treasures, dist)
+		testExpect(t, err, nil)
+
+		seen := make(map[string]bool)
+		woth, barren := 0, 0
+		for owl, hint := range hints {
+			hint = strings.ReplaceAll(hint, "\n", " ")
+			testExpect(t, isValidGameText(hint), true)
+			testExpect(t, seen[hint], false)
+			seen[hint] = true
+
+			switch {
+			case strings.HasSuffix(hint, "way of the hero."):
+				woth++
+				// the sword is needed to reach owl 1
+				if owl == "owl 1" {
+					testExpect(t, hint, "Cliff is on the way of the hero.")
+				}
+				// keys and dungeons don't count for the way of the hero
+				testExpect(t, hint != "Cave is on the way of the hero.", true)
+				testExpect(t,
+					hint != "Dungeon is on the way of the hero.", true)
+			case strings.HasSuffix(hint, "foolish."):
+				barren++
+				testExpect(t, hint, "Woods is foolish.")
+			}
+		}
+		testExpect(t, len(hints), 3)
+		// owl 1 can't use field as a woth hint, so there may only be one
+		testExpect(t, woth >= 1 && woth <= 2, true)
+		// there's only one barren area, since the cave's key is required, so
+		// the other falls back
+		testExpect(t, barren, 1)
+	}
+
+	// names in the distribution need to exist
+	dist.Items["seasons"] = []string{"hookshot"}
+	_, err = h.generate(rand.New(rand.NewSource(0)), g, func() {}, checks,
+		owls, gameSeasons, treasures, dist)
+	testExpect(t, err != nil, true)
+}
+
+func TestMultiworldHintText(t *testing.T) {
+	h := &hinter{
+		areas: map[string]string{"lake chest": "Eyeglass Lake"},
+		items: map[string]string{"feather": "Roc's Feather", "sword": "a Sword"},
+	}
+	h.player = 1
+	h.names = []string{"Link", "Player 2", "Zelda"}
+	h.hinters = map[int]*hinter{
+		2: {areas: map[string]string{"swamp chest": "Spool Swamp"}},
+	}
+
+	ownSlot, otherSlot := newNode("lake chest", andNode),
+		newNode("swamp chest", andNode)
+	ownSlot.player, otherSlot.player = 1, 2
+	ownItem, otherItem := newNode("sword", orNode), newNode("feather", orNode)
+	ownItem.player, otherItem.player = 1, 3
+
+	testExpect(t, h.slotArea(ownSlot), "your Eyeglass Lake")
+	testExpect(t, h.slotArea(otherSlot), "Player 2's Spool Swamp")
+	testExpect(t, h.itemName(ownItem), "your Sword")
+	testExpect(t, h.itemName(otherItem), "something for Zelda")
+	testExpect(t, h.format("Player 2's Spool Swamp holds your Sword."),
+		"Player 2's Spool\nSwamp holds your\nSword.")
+
+	// owners hints group items by area, in player order
+	h.hinters[3] = &hinter{areas: map[string]string{
+		"swamp chest": "Spool Swamp", "lake chest": "Eyeglass Lake"}}
+	thirdSlot, thirdItem := newNode("lake chest", andNode),
+		newNode("feather", orNode)
+	thirdSlot.player, thirdItem.player = 3, 1
+	otherItem.player = 1
+	checks := map[*node]*node{otherSlot: otherItem, thirdSlot: thirdItem}
+	testExpect(t, h.ownersHint([]*node{thirdSlot, otherSlot}, checks),
+		"Player 2's Spool Swamp has your Roc's Feather. "+
+			"Zelda's Eyeglass Lake has your Roc's Feather.")
+	otherItem.name = "sword"
+	thirdSlot.name, thirdSlot.player = "swamp chest", 2
+	testExpect(t, h.ownersHint([]*node{otherSlot, thirdSlot}, checks),
+		"Player 2's Spool Swamp has your Sword and your Roc's Feather.")
+
+	testExpect(t, checkPlayerName("Link"), nil)
+	testExpect(t, checkPlayerName("Gannondorfffff") != nil, true)
+	testExpect(t, checkPlayerName("a b") != nil, true)
+	testExpect(t, checkPlayerName("") != nil, true)
+}
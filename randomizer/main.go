@@ -1,6 +1,7 @@
 package randomizer
 
 import (
+	"bytes"
 	"crypto/sha1"
 	"flag"
 	"fmt"
@@ -54,57 +55,134 @@ func printErrf(s string, a ...interface{}) {
 
 // options specified on the command line or via the TUI
 var (
-	flagCpuProf  string
-	flagDevCmd   string
-	flagDungeons bool
-	flagHard     bool
-	flagIncludes string
-	flagNoUI     bool
-	flagPlan     string
-	flagMulti    string
-	flagPortals  bool
-	flagSeed     string
-	flagRace     bool
-	flagTreewarp bool
-	flagVerbose  bool
+	flagBaseline   string
+	flagCompanion  string
+	flagCount      int
+	flagCpuProf    string
+	flagCrossWorld float64
+	flagD6Pair     bool
+	flagDecouple   bool
+	flagDevCmd     string
+	flagDungeons   bool
+	flagFlute      string
+	flagHard       bool
+	flagIcons      bool
+	flagHints      string
+	flagIncludes   string
+	flagMaxSpheres int
+	flagMinDepth   int
+	flagMixWarps   bool
+	flagNoUI       bool
+	flagOutDir     string
+	flagPlan       string
+	flagPlando     string
+	flagPreset     string
+	flagMulti      string
+	flagMultiFill  string
+	flagPortals    bool
+	flagSeasons    string
+	flagSeasonSet  string
+	flagSeed       string
+	flagRace       bool
+	flagRaceKey    string
+	flagTreewarp   bool
+	flagVerbose    bool
 )
 
 type randomizerOptions struct {
-	treewarp bool
-	hard     bool
-	dungeons bool
-	portals  bool
-	plan     *plan
-	race     bool
-	seed     string
-	include  []string
-	game     int
-	players  int
+	treewarp   bool
+	hard       bool
+	icons      bool // show hash icons on file select
+	maxspheres int  // reroll seeds with more spheres than this
+	mindepth   int  // reroll seeds with less depth than this
+	dungeons   bool
+	portals    bool
+	decouple   bool
+	d6pair     bool
+	mixwarps   bool
+	companion  int // 0 for random
+	earlyflute bool
+	seasons    string            // see seasonModes
+	seasonset  map[string]string // area -> season
+	plan       *plan
+	plando     *plando
+	plandoPath string // for permalinks
+	hints      *hintDistribution
+	hintsPath  string   // for permalinks
+	name       string   // multiworld player name, for hints
+	names      []string // all multiworld player names
+	race       bool
+	racekey    string // secret for sealed race logs
+	seed       string
+	include    []string
+	game       int
+	players    int
+	multi      multiRules
 }
 
 // initFlags initializes the CLI/TUI option values and variables.
 func initFlags() {
 	flag.Usage = usage
+	flag.StringVar(&flagBaseline, "baseline", "",
+		"stats JSON from -devcmd stats, for -devcmd compare")
+	flag.StringVar(&flagCompanion, "companion", "random",
+		"animal companion: 'ricky', 'dimitri', 'moosh', or 'random'")
+	flag.IntVar(&flagCount, "count", 0,
+		"generate this many seeds from one ROM, with a manifest (see -outdir)")
 	flag.StringVar(&flagCpuProf, "cpuprofile", "",
 		"write CPU profile to file")
+	flag.Float64Var(&flagCrossWorld, "crossworld", 0.5,
+		"target fraction of multiworld items placed in other players' games")
+	flag.BoolVar(&flagD6Pair, "d6pair", false,
+		"keep ages d6 present and past entrances together in dungeon shuffle")
+	flag.BoolVar(&flagDecouple, "decouple", false,
+		"shuffle portal entrances and exits independently")
 	flag.StringVar(&flagDevCmd, "devcmd", "",
-		"subcommands are 'findaddr', 'showasm', 'stats', and 'hardstats'")
+		"subcommands are 'findaddr', 'showasm', 'stats', 'hardstats', "+
+			"'compare', 'checkplan', 'multiserver', and 'unseal'")
 	flag.BoolVar(&flagDungeons, "dungeons", false,
 		"shuffle dungeon entrances")
+	flag.StringVar(&flagFlute, "flute", "anywhere",
+		"flute placement: 'anywhere' or 'progression-early'")
 	flag.BoolVar(&flagHard, "hard", false,
 		"enable more difficult logic")
+	flag.BoolVar(&flagIcons, "icons", false,
+		"show seed hash icons instead of options on the file select screen")
+	flag.StringVar(&flagHints, "hints", "",
+		"owl hint distribution file (see hints/distribution.yaml)")
 	flag.StringVar(&flagIncludes, "include", "",
 		"comma-separated list of additional asm files to include")
+	flag.IntVar(&flagMaxSpheres, "maxspheres", 0,
+		"reroll until the seed has at most this many spheres")
+	flag.IntVar(&flagMinDepth, "mindepth", 0,
+		"reroll until required items span at least this many spheres")
+	flag.BoolVar(&flagMixWarps, "mixwarps", false,
+		"shuffle dungeons and portals as one pool (seasons; implies both)")
 	flag.BoolVar(&flagNoUI, "noui", false,
 		"use command line without prompts if input file is given")
+	flag.StringVar(&flagOutDir, "outdir", ".",
+		"output directory, relative to the input ROM's directory")
 	flag.StringVar(&flagPlan, "plan", "",
-		"use fixed 'randomization' from a file")
+		"use fixed 'randomization' from a file (with -multi, one per player)")
+	flag.StringVar(&flagPlando, "plando", "",
+		"randomize around placements and constraints in a YAML/JSON file")
+	flag.StringVar(&flagPreset, "preset", "",
+		"options from a YAML file or built-in preset: "+
+			strings.Join(presetNames(), ", "))
 	flag.StringVar(&flagMulti, "multi", "",
-		"comma-separated list of strings such as s+hdp or a+ht")
+		"comma-separated list of strings such as s+hdp, a+ht, or s:league")
+	flag.StringVar(&flagMultiFill, "multifill", "global",
+		"multiworld fill: 'global' or 'swap'")
 	flag.BoolVar(&flagPortals, "portals", false,
 		"shuffle subrosia portal connections (seasons)")
 	flag.BoolVar(&flagRace, "race", false,
 		"don't print full seed in file select screen or filename")
+	flag.StringVar(&flagRaceKey, "racekey", "",
+		"in race mode, write logs sealed with this key, or 'new'")
+	flag.StringVar(&flagSeasons, "seasons", "random",
+		"default seasons: 'vanilla', 'random', 'weighted', or 'chaos'")
+	flag.StringVar(&flagSeasonSet, "setseasons", "",
+		"comma-separated list of area:season default season overrides")
 	flag.StringVar(&flagSeed, "seed", "",
 		"specific random seed to use (32-bit hex number)")
 	flag.BoolVar(&flagTreewarp, "treewarp", false,
@@ -114,9 +192,33 @@ func initFlags() {
 	flag.Parse()
 }
 
-// parses options from a string like "s+dp" or "ages+hk" in a ropts.
+// parses options from a string like "s+dp" or "ages+hk" in a ropts, or from a
+// preset like "league" or "s:beginner". the string can be followed by
+// multiworld rules separated by slashes, like "s+dp/local=sword/rings". a
+// "name=" rule sets the player's name in hints.
 func roptsFromString(s string, ropts *randomizerOptions) error {
-	a := strings.Split(s, "+")
+	rules := strings.Split(s, "/")
+	isPreset, err := roptsFromPreset(rules[0], ropts)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules[1:] {
+		if strings.HasPrefix(rule, "name=") {
+			ropts.name = strings.TrimPrefix(rule, "name=")
+			if err := checkPlayerName(ropts.name); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := parseMultiRule(rule, &ropts.multi); err != nil {
+			return err
+		}
+	}
+	if isPreset {
+		return nil
+	}
+
+	a := strings.Split(rules[0], "+")
 	if len(a) == 0 || len(a) > 2 {
 		return fmt.Errorf("bad option string: %s", s)
 	}
@@ -133,16 +235,54 @@ func roptsFromString(s string, ropts *randomizerOptions) error {
 
 	// flags
 	if len(a) == 2 {
-		for _, c := range a[1] {
-			switch c {
+		flags := []rune(a[1])
+		for i := 0; i < len(flags); i++ {
+			switch c := flags[i]; c {
+			case '6':
+				ropts.d6pair = true
+			case 'a':
+				// followed by one character per season area
+				if i+len(seasonAreas) >= len(flags) {
+					return fmt.Errorf("bad season overrides: %s", a[1])
+				}
+				ropts.seasonset = make(map[string]string)
+				for j, area := range seasonAreas {
+					c := flags[i+1+j]
+					if c == 'n' {
+						continue
+					}
+					if c < '0' || int(c-'0') >= len(seasonsById) {
+						return fmt.Errorf("bad season overrides: %s", a[1])
+					}
+					ropts.seasonset[area] = seasonsById[c-'0']
+				}
+				i += len(seasonAreas)
 			case 'd':
 				ropts.dungeons = true
+			case 'f':
+				ropts.earlyflute = true
 			case 'h':
 				ropts.hard = true
+			case 'i':
+				ropts.companion = dimitri
+			case 'm':
+				ropts.mixwarps = true
+			case 'o':
+				ropts.companion = moosh
 			case 'p':
 				ropts.portals = true
+			case 'r':
+				ropts.companion = ricky
+			case 'k':
+				ropts.seasons = "chaos"
+			case 'v':
+				ropts.seasons = "vanilla"
+			case 'w':
+				ropts.seasons = "weighted"
 			case 't':
 				ropts.treewarp = true
+			case 'x':
+				ropts.decouple = true
 			default:
 				return fmt.Errorf("unknown flag: %v", c)
 			}
@@ -152,48 +292,179 @@ func roptsFromString(s string, ropts *randomizerOptions) error {
 	return nil
 }
 
-// the program's entry point.
-func Main() {
-	initFlags()
+// parses default season overrides from a string like
+// "north horon:winter,sunken city:summer".
+func parseSeasonOverrides(s string) (map[string]string, error) {
+	overrides := make(map[string]string)
+	if s == "" {
+		return overrides, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		a := strings.Split(pair, ":")
+		if len(a) != 2 {
+			return nil, fmt.Errorf("bad season override: %s", pair)
+		}
+		area, season := strings.TrimSpace(a[0]), strings.TrimSpace(a[1])
+		if getStringIndex(seasonAreas, area) == -1 {
+			return nil, fmt.Errorf("invalid season area: %s", area)
+		}
+		if getStringIndex(seasonsById, season) == -1 {
+			return nil, fmt.Errorf("invalid default season: %s", season)
+		}
+		overrides[area] = season
+	}
+	return overrides, nil
+}
 
-	if flagCpuProf != "" {
-		f, err := os.Create(flagCpuProf)
+// returns options from the command-line flags, or from the flags as set by the
+// settings form.
+func getOptions() ([]*randomizerOptions, error) {
+	presetGame := ""
+	if flagPreset != "" {
+		if flagMulti != "" {
+			return nil, fmt.Errorf("-preset can't be used with -multi; " +
+				"give a preset for each player instead")
+		}
+		p, err := loadPreset(flagPreset)
+		if err == nil {
+			err = p.setFlags()
+		}
 		if err != nil {
-			fatal(err, printErrf)
-			return
+			return nil, err
 		}
-		pprof.StartCPUProfile(f)
-		defer pprof.StopCPUProfile()
+		presetGame = p.Game
 	}
 
-	// get options
 	optsList := make([]*randomizerOptions, 0, 1)
+	if err := checkRaceKeyFlag(flagRaceKey, flagRace, flagDevCmd); err != nil {
+		return nil, err
+	}
+
 	include := strings.Split(flagIncludes, ",")
 	if flagMulti != "" {
+		if getStringIndex(multiFillModes, flagMultiFill) == -1 {
+			return nil, fmt.Errorf("unknown multiworld fill: %s", flagMultiFill)
+		}
+		if flagMaxSpheres != 0 || flagMinDepth != 0 {
+			return nil, fmt.Errorf("-maxspheres and -mindepth can't be used " +
+				"with -multi")
+		}
+		if flagCrossWorld < 0 || flagCrossWorld > 1 {
+			return nil, fmt.Errorf("crossworld must be between 0 and 1")
+		}
 		for i, s := range strings.Split(flagMulti, ",") {
 			optsList = append(optsList, &randomizerOptions{
 				race:    flagRace,
+				racekey: flagRaceKey,
+				icons:   flagIcons,
 				seed:    flagSeed,
 				include: include,
 			})
 			if err := roptsFromString(s, optsList[i]); err != nil {
-				fatal(err, printErrf)
-				return
+				return nil, err
 			}
 		}
 	} else {
+		companion := getStringIndex(companionNames, flagCompanion)
+		if companion == -1 {
+			return nil, fmt.Errorf("unknown companion: %s", flagCompanion)
+		}
+		if flagFlute != "anywhere" && flagFlute != "progression-early" {
+			return nil, fmt.Errorf("unknown flute placement: %s", flagFlute)
+		}
+		if getStringIndex(seasonModes, flagSeasons) == -1 {
+			return nil, fmt.Errorf("unknown season mode: %s", flagSeasons)
+		}
+		seasonset, err := parseSeasonOverrides(flagSeasonSet)
+		if err != nil {
+			return nil, err
+		}
+
 		optsList = append(optsList, &randomizerOptions{
-			race:     flagRace,
-			seed:     flagSeed,
-			treewarp: flagTreewarp,
-			hard:     flagHard,
-			dungeons: flagDungeons,
-			portals:  flagPortals,
-			include:  include,
+			race:       flagRace,
+			racekey:    flagRaceKey,
+			icons:      flagIcons,
+			maxspheres: flagMaxSpheres,
+			mindepth:   flagMinDepth,
+			seed:       flagSeed,
+			treewarp:   flagTreewarp,
+			hard:       flagHard,
+			dungeons:   flagDungeons,
+			portals:    flagPortals,
+			decouple:   flagDecouple,
+			d6pair:     flagD6Pair,
+			mixwarps:   flagMixWarps,
+			companion:  companion,
+			earlyflute: flagFlute == "progression-early",
+			seasons:    flagSeasons,
+			seasonset:  seasonset,
+			include:    include,
 		})
+		if presetGame != "" {
+			optsList[0].game = reverseLookupOrPanic(gameNames, presetGame).(int)
+		}
+	}
+	if flagPlando != "" {
+		if flagMulti != "" || flagPlan != "" {
+			return nil, fmt.Errorf("-plando can't be used with -multi or -plan")
+		}
+		p, err := loadPlando(flagPlando)
+		if err == nil {
+			err = p.applyOptions(optsList[0])
+		}
+		if err != nil {
+			return nil, err
+		}
+		optsList[0].plando = p
+		optsList[0].plandoPath = flagPlando
+	}
+	hints := defaultHintDistribution()
+	if flagHints != "" {
+		b, err := ioutil.ReadFile(flagHints)
+		if err == nil {
+			hints, err = loadHintDistribution(b)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	names := make([]string, len(optsList))
+	for i, ropts := range optsList {
+		names[i] = ternary(ropts.name != "", ropts.name,
+			fmt.Sprintf("Player %d", i+1)).(string)
 	}
 	for _, ropts := range optsList {
+		normalizeWarpOptions(ropts)
 		ropts.players = len(optsList)
+		if ropts.players > 1 {
+			ropts.names = names
+		}
+		ropts.hints = hints
+		ropts.hintsPath = flagHints
+	}
+
+	return optsList, nil
+}
+
+// the program's entry point.
+func Main() {
+	initFlags()
+
+	if flagCpuProf != "" {
+		f, err := os.Create(flagCpuProf)
+		if err != nil {
+			fatal(err, printErrf)
+			return
+		}
+		pprof.StartCPUProfile(f)
+		defer pprof.StopCPUProfile()
+	}
+
+	// get options
+	optsList, err := getOptions()
+	if err != nil {
+		fatal(err, printErrf)
+		return
 	}
 
 	switch flagDevCmd {
@@ -246,18 +517,142 @@ func Main() {
 			fatal(err, printErrf)
 			return
 		}
+		master, err := setRandomSeed(optsList[0].seed)
+		if err != nil {
+			fatal(err, printErrf)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "using master seed %08x\n", master)
 
-		rand.Seed(time.Now().UnixNano())
-
-		statFunc := logStats
 		if flagDevCmd == "hardstats" {
-			statFunc = logHardStats
+			err = logHardStats(game, numTrials, master, *optsList[0])
+		} else {
+			err = logStats(game, numTrials, master, *optsList[0], flag.Arg(2))
+		}
+		if err != nil {
+			fatal(err, printErrf)
+		}
+	case "compare":
+		// compare stats for current logic to a baseline. flags stop at the
+		// first argument, so also accept the baseline after the arguments.
+		if flag.NArg() == 4 && (flag.Arg(2) == "-baseline" ||
+			flag.Arg(2) == "--baseline") {
+			flagBaseline = flag.Arg(3)
+		} else if flag.NArg() != 2 {
+			flagBaseline = ""
+		}
+		if flagBaseline == "" {
+			fatal(fmt.Errorf("compare: usage: -baseline <stats.json> "+
+				"<game> <n>"), printErrf)
+			return
+		}
+		game := reverseLookupOrPanic(gameNames, flag.Arg(0)).(int)
+		numTrials, err := strconv.Atoi(flag.Arg(1))
+		if err != nil {
+			fatal(err, printErrf)
+			return
+		}
+		base, err := loadSeedStats(flagBaseline)
+		if err != nil {
+			fatal(err, printErrf)
+			return
+		}
+		if err := checkBaseline(base, game, *optsList[0],
+			printErrf); err != nil {
+			fatal(err, printErrf)
+			return
 		}
-		statFunc(game, numTrials, *optsList[0],
+		master, err := setRandomSeed(optsList[0].seed)
+		if err != nil {
+			fatal(err, printErrf)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "using master seed %08x\n", master)
+
+		cur, err := getSeedStats(game, numTrials, master, *optsList[0])
+		if err != nil {
+			fatal(err, printErrf)
+			return
+		}
+		if !compareStats(base, cur).log(base, cur,
+			func(s string, a ...interface{}) {
+				fmt.Printf(s, a...)
+				fmt.Println()
+			}) {
+			os.Exit(1)
+		}
+	case "multiserver":
+		// relay items between multiworld players; args are listen address,
+		// then generated ROMs
+		if flag.NArg() < 3 {
+			fatal(fmt.Errorf("multiserver: usage: <addr> <rom> <rom>..."),
+				printErrf)
+			return
+		}
+		if err := runMultiServer(flag.Arg(0), flag.Args()[1:],
+			func(s string, a ...interface{}) {
+				fmt.Printf(s, a...)
+				fmt.Println()
+			}); err != nil {
+			fatal(err, printErrf)
+			return
+		}
+	case "unseal":
+		// decrypt and verify a race log; args are sealed log, then
+		// optionally the ROM
+		if flag.NArg() < 1 || flag.NArg() > 2 || flagRaceKey == "" {
+			fatal(fmt.Errorf(
+				"unseal: usage: -racekey <key> <log.sealed> [rom]"),
+				printErrf)
+			return
+		}
+		plaintext, commitment, err := unsealLog(
+			flag.Arg(0), flag.Arg(1), flagRaceKey)
+		if err != nil {
+			fatal(err, printErrf)
+			return
+		}
+		outPath := strings.TrimSuffix(flag.Arg(0), ".sealed")
+		if outPath == flag.Arg(0) {
+			outPath += ".txt"
+		}
+		if err := ioutil.WriteFile(outPath, plaintext, 0644); err != nil {
+			fatal(err, printErrf)
+			return
+		}
+		fmt.Printf("verified log with commitment %s\n", commitment)
+		fmt.Printf("wrote log file to %s\n", outPath)
+	case "checkplan":
+		// check that a plan is beatable without writing a ROM; args are game
+		// and plan file
+		if flag.NArg() != 2 {
+			fatal(fmt.Errorf("checkplan: usage: <game> <plan>"), printErrf)
+			return
+		}
+		game, ok := reverseLookup(gameNames, flag.Arg(0))
+		if !ok {
+			fatal(fmt.Errorf("checkplan: no such game: %s", flag.Arg(0)),
+				printErrf)
+			return
+		}
+		p, err := parseSummary(flag.Arg(1), game.(int))
+		if err != nil {
+			fatal(err, printErrf)
+			return
+		}
+		rom := newRomState(nil, game.(int), 1, optsList[0].include)
+		beatable, err := checkPlan(rom, p, optsList[0].hard,
 			func(s string, a ...interface{}) {
 				fmt.Printf(s, a...)
 				fmt.Println()
 			})
+		if err != nil {
+			fatal(err, printErrf)
+			return
+		}
+		if !beatable {
+			os.Exit(1)
+		}
 	case "showasm":
 		// print the asm for the named function/etc
 		tokens := strings.Split(flag.Arg(0), "/")
@@ -275,7 +670,22 @@ func Main() {
 		}
 	case "":
 		// no devcmd, run randomizer normally
-		if flagMulti != "" ||
+		if flagCount > 0 {
+			// batch mode, CLI only
+			if flagMulti != "" || flagPlan != "" || flagPlando != "" ||
+				flag.NArg() != 1 {
+				fatal(fmt.Errorf("usage: -count <n> [-outdir <dir>] <rom>; "+
+					"-multi, -plan, and -plando are not supported"), printErrf)
+				return
+			}
+			if err := runBatch(flag.Arg(0), flagOutDir, flagCount,
+				*optsList[0], func(s string, a ...interface{}) {
+					fmt.Printf(s, a...)
+					fmt.Println()
+				}); err != nil {
+				fatal(err, printErrf)
+			}
+		} else if flagMulti != "" ||
 			(flag.NArg() > 0 && flag.NArg()+flag.NFlag() > 1) { // CLI used
 			// run randomizer on main goroutine
 			runRandomizer(nil, optsList, func(s string, a ...interface{}) {
@@ -285,9 +695,7 @@ func Main() {
 		} else { // CLI maybe not used
 			// run TUI on main goroutine and randomizer on alternate goroutine
 			ui := newUI("oracles randomizer " + version)
-			go runRandomizer(ui, optsList, func(s string, a ...interface{}) {
-				ui.printf(s, a...)
-			})
+			go runSettingsForm(ui)
 			ui.run()
 		}
 	default:
@@ -295,6 +703,33 @@ func Main() {
 	}
 }
 
+// shows the TUI settings form, then runs the randomizer with the chosen
+// settings.
+func runSettingsForm(ui *uiInstance) {
+	logf := func(s string, a ...interface{}) {
+		ui.printf(s, a...)
+	}
+
+	path := settingsPath()
+	values := loadSettings(path)
+	if !ui.settingsForm(values, filepath.Dir(path)) {
+		return
+	}
+	if path != "" {
+		if err := saveSettings(path, values); err != nil {
+			logf("couldn't save settings: %v", err)
+		}
+	}
+
+	optsList, err := settingsOptions(values)
+	if err != nil {
+		fatal(err, logf)
+		ui.done()
+		return
+	}
+	runRandomizer(ui, optsList, logf)
+}
+
 // run the main randomizer routine, printing messages via logf, which should
 // act analogously to fmt.Printf with added newline.
 func runRandomizer(ui *uiInstance, optsList []*randomizerOptions, logf logFunc) {
@@ -305,19 +740,17 @@ func runRandomizer(ui *uiInstance, optsList []*randomizerOptions, logf logFunc)
 		}
 	}()
 
+	if err := setNewRaceKey(optsList, logf); err != nil {
+		fatal(err, logf)
+		return
+	}
+
 	// if rom is to be randomized, infile must be non-empty after switch
 	dirName, infiles, outfiles := getRomPaths(ui, optsList, logf)
 	if infiles != nil {
 		roms := make([]*romState, len(infiles))
 		routes := make([]*routeInfo, len(infiles))
 
-		if ui != nil {
-			if ui.doPrompt("use specific seed? (y/n)") == 'y' {
-				optsList[0].seed =
-					ui.promptSeed("enter seed: (8-digit hex number)")
-				logf("using seed %s.", optsList[0].seed)
-			}
-		}
 		seed, err := setRandomSeed(optsList[0].seed)
 		if err != nil {
 			fatal(err, logf)
@@ -325,6 +758,20 @@ func runRandomizer(ui *uiInstance, optsList []*randomizerOptions, logf logFunc)
 		}
 		src := rand.New(rand.NewSource(int64(seed)))
 
+		// multiworld plans need to be parsed together, one file per player
+		var plans []*plan
+		if flagPlan != "" && len(infiles) > 1 {
+			games := make([]int, len(optsList))
+			for i, ropts := range optsList {
+				games[i] = ropts.game
+			}
+			plans, err = parseMultiSummary(strings.Split(flagPlan, ","), games)
+			if err != nil {
+				fatal(err, logf)
+				return
+			}
+		}
+
 		// get input for instance
 		for i, infile := range infiles {
 			ropts := optsList[i]
@@ -349,14 +796,16 @@ func runRandomizer(ui *uiInstance, optsList []*randomizerOptions, logf logFunc)
 			}
 
 			logf("randomizing %s.", infile)
-			getAndLogOptions(game, ui, ropts, logf)
+			logOptions(game, ropts, logf)
 			if ui != nil {
 				logf("")
 			}
 
 			roms[i].setTreewarp(ropts.treewarp)
 
-			if flagPlan != "" {
+			if plans != nil {
+				ropts.plan = plans[i]
+			} else if flagPlan != "" {
 				var err error
 				ropts.plan, err = parseSummary(flagPlan, game)
 				if err != nil {
@@ -366,7 +815,21 @@ func runRandomizer(ui *uiInstance, optsList []*randomizerOptions, logf logFunc)
 			}
 
 			// find routes
-			if ropts.plan == nil {
+			if err := checkWarpOptions(game, ropts); err != nil {
+				fatal(err, logf)
+				return
+			}
+			if ropts.plan == nil && len(infiles) == 1 {
+				// single-player seeds can be rerolled to meet constraints
+				route, err := findConstrainedRoute(
+					roms[i], seed, *ropts, flagVerbose, logf)
+				if err != nil {
+					fatal(err, logf)
+					return
+				}
+				routes[i] = route
+				seed = route.seed
+			} else if ropts.plan == nil {
 				route, err := findRoute(
 					roms[i], seed, src, *ropts, flagVerbose, logf)
 				if err != nil {
@@ -382,12 +845,32 @@ func runRandomizer(ui *uiInstance, optsList []*randomizerOptions, logf logFunc)
 				}
 				routes[i] = route
 				ropts.dungeons = route.entrances != nil && len(route.entrances) > 0
-				ropts.portals = route.portals != nil && len(route.portals) > 0
+				ropts.mixwarps = warpsMixed(route.entrances)
+				ropts.portals = (route.portals != nil &&
+					len(route.portals) > 0) || ropts.mixwarps
+				ropts.decouple = portalsDecoupled(
+					route.portals, route.portalExits)
+				if len(ropts.plan.animal) != 0 {
+					ropts.companion = route.companion
+				}
 			}
 		}
 
-		if len(routes) > 1 {
-			shuffleMultiworld(routes, roms, flagVerbose, logf)
+		if plans != nil {
+			if err := linkPlannedMultiworld(routes, roms, plans); err != nil {
+				fatal(err, logf)
+				return
+			}
+		} else if len(routes) > 1 {
+			rules := make([]multiRules, len(optsList))
+			for i, ropts := range optsList {
+				rules[i] = ropts.multi
+			}
+			if err := shuffleMultiworld(routes, roms, rules, flagMultiFill,
+				flagCrossWorld, flagVerbose, logf); err != nil {
+				fatal(err, logf)
+				return
+			}
 		}
 
 		// come up with log data
@@ -404,10 +887,22 @@ func runRandomizer(ui *uiInstance, optsList []*randomizerOptions, logf logFunc)
 
 		// accumulate all treasures for reference by log functions
 		treasures := make(map[string]*treasure)
-		for _, rom := range roms {
+		games := make([]int, len(roms))
+		for i, rom := range roms {
 			for k, v := range rom.treasures {
 				treasures[k] = v
 			}
+			games[i] = rom.game
+		}
+
+		// relative output directories are relative to the input directory
+		outDir := flagOutDir
+		if !filepath.IsAbs(outDir) {
+			outDir = filepath.Join(dirName, outDir)
+		}
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			fatal(err, logf)
+			return
 		}
 
 		// write roms
@@ -427,19 +922,38 @@ func runRandomizer(ui *uiInstance, optsList []*randomizerOptions, logf logFunc)
 			}
 			logFilename := strings.Replace(outfile, ".gbc", "", 1) + "_log.txt"
 
-			sum, err := applyRoute(rom, routes[i], dirName, logFilename, ropts,
-				checks, spheres, extra, g, resetFunc, treasures, flagVerbose, logf)
+			sum, err := applyRoute(rom, routes[i], outDir, logFilename, ropts,
+				games, checks, spheres, extra, g, resetFunc, treasures,
+				flagVerbose, logf)
 			if err != nil {
 				fatal(err, logf)
 				return
 			}
 
-			if writeRom(rom.data, dirName, outfile, logFilename, seed, sum, logf); err != nil {
+			if writeRom(rom.data, outDir, outfile, logFilename, seed, sum, logf); err != nil {
 				fatal(err, logf)
 				return
 			}
 		}
 
+		// combined multiworld logs
+		if len(roms) > 1 && plans == nil && !optsList[0].race {
+			prefix := filepath.Join(outDir,
+				fmt.Sprintf("multirando_%s_%08x", version, seed))
+			if err := writeMultiPlaythrough(prefix+"_playthrough.txt",
+				seed, games, checks, spheres, extra, g, resetFunc,
+				treasures); err != nil {
+				fatal(err, logf)
+				return
+			}
+			if err := writeItemLedger(
+				prefix+"_ledger.csv", games, checks, spheres); err != nil {
+				fatal(err, logf)
+				return
+			}
+			logf("wrote multiworld playthrough and ledger to %s_*", prefix)
+		}
+
 		for _, ri := range routes {
 			ri.graph["start"].removeParent(g["start"])
 			g["done"].removeParent(ri.graph["done"])
@@ -522,30 +1036,35 @@ func getRomPaths(ui *uiInstance, optsList []*randomizerOptions,
 	return dir, in, out
 }
 
-// getAndLogOptions logs values of selected options, prompting for them first
-// if the TUI is used.
-func getAndLogOptions(game int, ui *uiInstance, ropts *randomizerOptions,
-	logf logFunc) {
-	if ui != nil {
-		ropts.hard = ui.doPrompt("enable hard difficulty? (y/n)") == 'y'
-	}
+// logs values of selected options.
+func logOptions(game int, ropts *randomizerOptions, logf logFunc) {
 	logf("using %s difficulty.", ternary(ropts.hard, "hard", "normal"))
-
-	if ui != nil {
-		ropts.treewarp = ui.doPrompt("enable tree warp? (y/n)") == 'y'
-	}
 	logf("tree warp %s.", ternary(ropts.treewarp, "on", "off"))
+	logf("dungeon shuffle %s.", ternary(ropts.dungeons, "on", "off"))
+	if ropts.dungeons && game == gameAges {
+		logf("d6 pairing %s.", ternary(ropts.d6pair, "on", "off"))
+	}
 
-	if ui != nil {
-		ropts.dungeons = ui.doPrompt("shuffle dungeons? (y/n)") == 'y'
+	if game == gameSeasons {
+		logf("portal shuffle %s.", ternary(ropts.portals, "on", "off"))
+		if ropts.dungeons && ropts.portals {
+			logf("dungeon/portal mixing %s.",
+				ternary(ropts.mixwarps, "on", "off"))
+		}
 	}
-	logf("dungeon shuffle %s.", ternary(ropts.dungeons, "on", "off"))
+	if ropts.portals {
+		logf("decoupled portals %s.", ternary(ropts.decouple, "on", "off"))
+	}
+	logf("animal companion: %s.", companionNames[ropts.companion])
+	logf("flute placement: %s.",
+		ternary(ropts.earlyflute, "progression-early", "anywhere"))
 
 	if game == gameSeasons {
-		if ui != nil {
-			ropts.portals = ui.doPrompt("shuffle portals? (y/n)") == 'y'
+		logf("default seasons: %s.",
+			ternary(ropts.seasons == "", "random", ropts.seasons))
+		for _, area := range orderedKeys(ropts.seasonset) {
+			logf("%s default season: %s.", area, ropts.seasonset[area])
 		}
-		logf("portal shuffle %s.", ternary(ropts.portals, "on", "off"))
 	}
 }
 
@@ -688,27 +1207,91 @@ func setRandomSeed(hexString string) (uint32, error) {
 
 // messes up rom data and writes it to a file.
 func applyRoute(rom *romState, ri *routeInfo, dirName, logFilename string,
-	ropts *randomizerOptions, checks map[*node]*node, spheres [][]*node,
+	ropts *randomizerOptions, games []int, checks map[*node]*node,
+	spheres [][]*node,
 	extra []*node, g graph, resetFunc func(), treasures map[string]*treasure,
 	verbose bool, logf logFunc) ([]byte, error) {
-	checksum, err := setRomData(rom, ri, ropts, logf, verbose)
+	owlHints, err := getOwlHints(rom, ri, ropts, games, checks, g, resetFunc,
+		treasures)
 	if err != nil {
 		return nil, err
 	}
 
-	// write spoiler log
-	if ropts.plan == nil && !ropts.race {
-		writeSummary(filepath.Join(dirName, logFilename), checksum, *ropts,
-			rom, ri, checks, spheres, extra, g, resetFunc, treasures, nil)
+	checksum, err := setRomData(rom, ri, owlHints, ropts, logf, verbose)
+	if err != nil {
+		return nil, err
+	}
+
+	// write spoiler log. sealed logs are only written once encrypted.
+	logPath := filepath.Join(dirName, logFilename)
+	if ropts.plan == nil && ropts.race && ropts.racekey != "" {
+		var b bytes.Buffer
+		writeSummary(&b, checksum, *ropts, rom, ri, games, checks,
+			spheres, extra, g, resetFunc, treasures, owlHints)
+		commitment, err := sealLog(
+			logPath+".sealed", b.Bytes(), checksum, ropts.racekey)
+		if err != nil {
+			return nil, err
+		}
+		logf("wrote sealed log file to %s.sealed", logFilename)
+		logf("log commitment: %s", commitment)
+	} else if ropts.plan == nil && !ropts.race {
+		f, err := os.Create(logPath)
+		if err != nil {
+			return nil, err
+		}
+		writeSummary(f, checksum, *ropts, rom, ri, games, checks,
+			spheres, extra, g, resetFunc, treasures, owlHints)
+		if err := f.Close(); err != nil {
+			return nil, err
+		}
 	}
 
 	return checksum, nil
 }
 
+// returns owl hints for a ROM, from the plan if there is one.
+func getOwlHints(rom *romState, ri *routeInfo, ropts *randomizerOptions,
+	games []int, checks map[*node]*node, g graph, resetFunc func(),
+	treasures map[string]*treasure) (map[string]string, error) {
+	h := newHinter(rom.game)
+	h.player = rom.player
+	if len(ropts.names) > 1 {
+		h.setMultiworld(rom.player, games, ropts.names)
+	}
+	owls := make(map[string]*node)
+	for name := range getOwlIds(rom.game) {
+		owls[name] = ri.graph[name]
+	}
+
+	if ropts.plan != nil {
+		owlHints := make(map[string]string)
+		for name := range owls {
+			owlHints[name] = ""
+		}
+		return owlHints, planOwlHints(ropts.plan, h, owlHints)
+	}
+
+	// only hint at checks in the player's own world, or that hold the
+	// player's items
+	playerChecks := make(map[*node]*node)
+	for slot, item := range checks {
+		if h.isOwn(slot) || (h.names != nil && h.isOwn(item)) {
+			playerChecks[slot] = item
+		}
+	}
+	owlHints, err := h.generate(ri.src, g, resetFunc, playerChecks, owls,
+		rom.game, treasures, ropts.hints)
+	if err == nil && ropts.plando != nil {
+		err = ropts.plando.applyHints(h, owlHints)
+	}
+	return owlHints, err
+}
+
 // mutates the rom data in-place based on the given route. this doesn't write
 // the file.
-func setRomData(rom *romState, ri *routeInfo, ropts *randomizerOptions,
-	logf logFunc, verbose bool) ([]byte, error) {
+func setRomData(rom *romState, ri *routeInfo, owlHints map[string]string,
+	ropts *randomizerOptions, logf logFunc, verbose bool) ([]byte, error) {
 	// place selected treasures in slots
 	checks := getChecks(ri.usedItems, ri.usedSlots)
 	for slot, item := range checks {
@@ -731,23 +1314,47 @@ func setRomData(rom *romState, ri *routeInfo, ropts *randomizerOptions,
 	}
 
 	rom.setAnimal(ri.companion)
+	rom.setStartingItems(ri.startItems)
 
-	warps := make(map[string]string)
+	warps, exits, err := getWarpMaps(rom, ri, ropts)
+	if err != nil {
+		return nil, err
+	}
+
+	rom.setOwlData(owlHints)
+
+	// do it! (but don't write anything)
+	return rom.mutate(warps, exits, ri.seed, ropts)
+}
+
+// returns the maps of warp entrances and exits to shuffle for a route.
+func getWarpMaps(rom *romState, ri *routeInfo,
+	ropts *randomizerOptions) (map[string]string, map[string]string, error) {
+	warps, exits := make(map[string]string), make(map[string]string)
 	if ropts.dungeons {
+		// in mixed mode, the entrance map already uses warp names
 		for k, v := range ri.entrances {
 			warps[k] = v
+			exits[v] = k
 		}
 	}
-	if ropts.portals {
+	if ropts.portals && !ropts.mixwarps {
 		for k, v := range ri.portals {
 			holodrumV, _ := reverseLookup(subrosianPortalNames, v)
 			warps[fmt.Sprintf("%s portal", k)] =
 				fmt.Sprintf("%s portal", holodrumV)
 		}
+		for k, v := range ri.portalExits {
+			holodrumK, _ := reverseLookup(subrosianPortalNames, k)
+			exits[fmt.Sprintf("%s portal", holodrumK)] =
+				fmt.Sprintf("%s portal", v)
+		}
+	}
+	if err := checkWarpOptions(rom.game, ropts); err != nil {
+		return nil, nil, err
 	}
 
-	// do it! (but don't write anything)
-	return rom.mutate(warps, ri.seed, ropts)
+	return warps, exits, nil
 }
 
 // returns a string representing a seed/has plus the randomizer options that
@@ -775,7 +1382,11 @@ func optString(seed uint32, ropts *randomizerOptions, flagSep string) string {
 		s += fmt.Sprintf("%08x", seed)
 	}
 
-	if ropts.treewarp || ropts.hard || ropts.dungeons || ropts.portals {
+	if ropts.treewarp || ropts.hard || ropts.dungeons || ropts.portals ||
+		ropts.d6pair || ropts.mixwarps || ropts.companion != 0 ||
+		ropts.earlyflute ||
+		(ropts.seasons != "" && ropts.seasons != "random") ||
+		len(ropts.seasonset) != 0 {
 		// these are in chronological order of introduction, for no particular
 		// reason.
 		s += flagSep
@@ -791,11 +1402,56 @@ func optString(seed uint32, ropts *randomizerOptions, flagSep string) string {
 		if ropts.portals {
 			s += "p"
 		}
+		if ropts.decouple && ropts.portals {
+			s += "x"
+		}
+		if ropts.d6pair {
+			s += "6"
+		}
+		if ropts.mixwarps {
+			s += "m"
+		}
+		switch ropts.companion {
+		case ricky:
+			s += "r"
+		case dimitri:
+			s += "i"
+		case moosh:
+			s += "o"
+		}
+		if ropts.earlyflute {
+			s += "f"
+		}
+		switch ropts.seasons {
+		case "vanilla":
+			s += "v"
+		case "weighted":
+			s += "w"
+		case "chaos":
+			s += "k"
+		}
+		if len(ropts.seasonset) != 0 {
+			s += "a" + seasonOverrideString(ropts.seasonset)
+		}
 	}
 
 	return s
 }
 
+// returns default season overrides as a string of one character per area in
+// seasonAreas: the season's ID, or "n" if the area isn't overridden.
+func seasonOverrideString(overrides map[string]string) string {
+	s := ""
+	for _, area := range seasonAreas {
+		if season, ok := overrides[area]; ok {
+			s += fmt.Sprint(getStringIndex(seasonsById, season))
+		} else {
+			s += "n"
+		}
+	}
+	return s
+}
+
 // reverseLookup looks up the key for a given map value. If multiple keys are
 // associated with the same value, it will return one of those keys at random.
 func reverseLookup(m, match interface{}) (interface{}, bool) {
@@ -0,0 +1,154 @@
+package randomizer
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// items whose sphere is reported as a measure of how deep progression goes.
+var metricsKeyItems = []string{"sword", "feather", "flippers"}
+
+// numbers describing the shape of a single-player seed.
+type seedMetrics struct {
+	spheres         int            // including spheres with only junk
+	depth           int            // spheres up to the last required item
+	requiredChecks  int            // checks with required items, incl. keys
+	dungeonChecks   int            // required checks in dungeons
+	overworldChecks int            // required checks outside dungeons
+	dungeonRequired map[string]int // dungeon name -> required checks
+	itemDepths      map[string]int // key item -> sphere, if reachable
+	hardTricks      []string       // names of required hard logic nodes
+}
+
+// computes metrics for a route, given data from getAllSpheres.
+func getSeedMetrics(ri *routeInfo, game int, g graph,
+	checks map[*node]*node, spheres [][]*node,
+	treasures map[string]*treasure, resetFunc func()) *seedMetrics {
+	m := &seedMetrics{
+		spheres:         len(spheres),
+		dungeonRequired: make(map[string]int),
+		itemDepths:      make(map[string]int),
+	}
+
+	// required checks, by location
+	prog, _ := filterJunk(g, checks, treasures, resetFunc)
+	m.requiredChecks = len(prog)
+	for slot := range prog {
+		if dungeon := getDungeonName(slot.name); dungeon != "" {
+			m.dungeonChecks++
+			m.dungeonRequired[dungeon]++
+		} else {
+			m.overworldChecks++
+		}
+	}
+
+	// depth of progression and key items
+	for i, sphere := range spheres {
+		for _, n := range sphere {
+			item := checks[n]
+			if item == nil {
+				continue
+			}
+			if prog[n] != nil {
+				m.depth = i + 1
+			}
+			for _, name := range metricsKeyItems {
+				if _, ok := m.itemDepths[name]; !ok && item.name == name {
+					m.itemDepths[name] = i
+				}
+			}
+		}
+	}
+
+	// hard tricks, using nice names where possible
+	nameMap := ternary(game == gameSeasons,
+		seasonsTrickNames, agesTrickNames).(map[string]string)
+	tricks := make(map[string]bool)
+	for _, name := range getRequiredHardNodes(ri) {
+		tricks[ternary(nameMap[name] != "", nameMap[name], name).(string)] =
+			true
+	}
+	m.hardTricks = orderedKeys(tricks)
+
+	g.reset()
+	resetFunc()
+
+	return m
+}
+
+// returns metrics for a route that isn't linked to other routes.
+func getRouteMetrics(ri *routeInfo, game int,
+	treasures map[string]*treasure) *seedMetrics {
+	g, checks, spheres, _ := getAllSpheres([]*routeInfo{ri})
+	m := getSeedMetrics(ri, game, g, checks, spheres, treasures,
+		func() { ri.graph.reset() })
+	ri.graph["start"].removeParent(g["start"])
+	g["done"].removeParent(ri.graph["done"])
+	return m
+}
+
+// returns lines describing metrics, for logs and stats.
+func (m *seedMetrics) lines() []string {
+	lines := []string{
+		fmt.Sprintf("spheres: %d", m.spheres),
+		fmt.Sprintf("depth: %d", m.depth),
+		fmt.Sprintf("required checks: %d (%d dungeon, %d overworld)",
+			m.requiredChecks, m.dungeonChecks, m.overworldChecks),
+	}
+	for _, name := range metricsKeyItems {
+		if depth, ok := m.itemDepths[name]; ok {
+			lines = append(lines, fmt.Sprintf("%s sphere: %d", name, depth))
+		}
+	}
+	for _, dungeon := range orderedKeys(m.dungeonRequired) {
+		lines = append(lines, fmt.Sprintf("%s required checks: %d",
+			dungeon, m.dungeonRequired[dungeon]))
+	}
+	lines = append(lines, fmt.Sprintf("hard tricks: %d", len(m.hardTricks)))
+	return lines
+}
+
+// returns an error describing the first metrics constraint that isn't met,
+// or nil if all are met. zero values mean no constraint.
+func (m *seedMetrics) check(ropts *randomizerOptions) error {
+	if ropts.maxspheres > 0 && m.spheres > ropts.maxspheres {
+		return fmt.Errorf("%d spheres > %d", m.spheres, ropts.maxspheres)
+	}
+	if ropts.mindepth > 0 && m.depth < ropts.mindepth {
+		return fmt.Errorf("depth %d < %d", m.depth, ropts.mindepth)
+	}
+	return nil
+}
+
+// the number of seeds to try before giving up on metrics constraints.
+const maxMetricsRerolls = 100
+
+// calls findRoute until a route meets the options' metrics constraints,
+// rerolling the seed from the previous one each time. a rerolled seed
+// reproduces the route when given as -seed with the same options.
+func findConstrainedRoute(rom *romState, seed uint32, ropts randomizerOptions,
+	verbose bool, logf logFunc) (*routeInfo, error) {
+	reroll := rand.New(rand.NewSource(int64(seed)))
+	for i := 0; i < maxMetricsRerolls; i++ {
+		src := rand.New(rand.NewSource(int64(seed)))
+		ri, err := findRoute(rom, seed, src, ropts, verbose, logf)
+		if err != nil {
+			return nil, err
+		}
+		if ropts.maxspheres == 0 && ropts.mindepth == 0 {
+			return ri, nil
+		}
+
+		err = getRouteMetrics(ri, rom.game, rom.treasures).check(&ropts)
+		if err == nil {
+			return ri, nil
+		}
+		if verbose {
+			logf("seed %08x rejected: %v", seed, err)
+		}
+		seed = reroll.Uint32()
+	}
+
+	return nil, fmt.Errorf("no seed met metrics constraints after %d tries",
+		maxMetricsRerolls)
+}
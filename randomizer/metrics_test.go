@@ -0,0 +1,63 @@
+package randomizer
+
+import (
+	"container/list"
+	"testing"
+)
+
+func TestSeedMetrics(t *testing.T) {
+	// sword opens d1, feather and a hard trick open the cliff, and flippers
+	// finish the game.
+	g := newGraph()
+	for _, name := range []string{"start", "hard", "chest", "junk chest",
+		"d1 chest", "cliff trick", "cliff chest", "done"} {
+		g[name] = newNode(name, andNode)
+	}
+	for _, name := range []string{"sword", "feather", "flippers", "junk"} {
+		g[name] = newNode(name, orNode)
+	}
+	g.addParents(map[string][]string{
+		"hard":        {"start"},
+		"chest":       {"start"},
+		"junk chest":  {"start"},
+		"d1 chest":    {"sword"},
+		"cliff trick": {"hard", "feather"},
+		"cliff chest": {"cliff trick"},
+		"done":        {"flippers"},
+	})
+	ri := &routeInfo{graph: g, usedItems: list.New(), usedSlots: list.New()}
+	for slot, item := range map[string]string{
+		"chest":       "sword",
+		"junk chest":  "junk",
+		"d1 chest":    "feather",
+		"cliff chest": "flippers",
+	} {
+		g[item].addParent(g[slot])
+		ri.usedItems.PushBack(g[item])
+		ri.usedSlots.PushBack(g[slot])
+	}
+	treasures := map[string]*treasure{
+		"sword":    {id: 0x05},
+		"feather":  {id: 0x17},
+		"flippers": {id: 0x2e},
+		"junk":     {id: 0x29},
+	}
+
+	m := getRouteMetrics(ri, gameSeasons, treasures)
+	testExpect(t, m.spheres, 3)
+	testExpect(t, m.depth, 3)
+	testExpect(t, m.requiredChecks, 3)
+	testExpect(t, m.dungeonChecks, 1)
+	testExpect(t, m.overworldChecks, 2)
+	testExpect(t, m.dungeonRequired, map[string]int{"d1": 1})
+	testExpect(t, m.itemDepths,
+		map[string]int{"sword": 0, "feather": 1, "flippers": 2})
+	testExpect(t, m.hardTricks, []string{"cliff trick"})
+
+	// constraints
+	testExpect(t, m.check(&randomizerOptions{}), nil)
+	testExpect(t, m.check(&randomizerOptions{maxspheres: 3}), nil)
+	testExpect(t, m.check(&randomizerOptions{maxspheres: 2}) != nil, true)
+	testExpect(t, m.check(&randomizerOptions{mindepth: 3}), nil)
+	testExpect(t, m.check(&randomizerOptions{mindepth: 4}) != nil, true)
+}
@@ -2,8 +2,10 @@ package randomizer
 
 import (
 	"container/list"
+	"fmt"
 	"math/rand"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -12,23 +14,190 @@ type multiRoute struct {
 	ri     *routeInfo
 	local  map[*node]bool
 	checks map[*node]*node
+	rules  multiRules
+}
+
+// per-player multiworld placement rules, from the -multi option string.
+type multiRules struct {
+	local      []string // items that stay in the player's own game
+	remote     []string // items that go to other players' games
+	noDungeons []int    // players whose dungeons can't hold the player's items
+	rings      bool     // rings can cross worlds
+	shops      bool     // shop slots can hold other players' items
+}
+
+// parses a rule like "local=sword.feather" or "rings" into a rules struct.
+// item names match by substring, so "flute" matches all flutes.
+func parseMultiRule(s string, rules *multiRules) error {
+	a := strings.SplitN(s, "=", 2)
+	switch {
+	case a[0] == "rings" && len(a) == 1:
+		rules.rings = true
+	case a[0] == "shops" && len(a) == 1:
+		rules.shops = true
+	case (a[0] == "local" || a[0] == "remote") && len(a) == 2:
+		patterns := strings.Split(a[1], ".")
+		for _, pattern := range patterns {
+			if err := checkMultiPattern(pattern); err != nil {
+				return err
+			}
+		}
+		if a[0] == "local" {
+			rules.local = append(rules.local, patterns...)
+		} else {
+			rules.remote = append(rules.remote, patterns...)
+		}
+	case a[0] == "nodungeons" && len(a) == 2:
+		for _, v := range strings.Split(a[1], ".") {
+			player, err := strconv.Atoi(v)
+			if err != nil || player < 1 {
+				return fmt.Errorf("bad player number: %s", v)
+			}
+			rules.noDungeons = append(rules.noDungeons, player)
+		}
+	default:
+		return fmt.Errorf("unknown multiworld rule: %s", s)
+	}
+	return nil
+}
+
+// returns an error if a local or remote item pattern can't match any item that
+// the multiworld shuffle moves, since the rule would do nothing. rings count
+// as movable, since the rings rule can make them so.
+func checkMultiPattern(pattern string) error {
+	if pattern == "" {
+		return fmt.Errorf("empty item name in multiworld rule")
+	}
+	matched := false
+	for _, game := range []int{gameSeasons, gameAges} {
+		for name := range loadTreasures(nil, game) {
+			if strings.Contains(name, pattern) {
+				if !staysInOwnGame(name) {
+					return nil
+				}
+				matched = true
+			}
+		}
+	}
+	if matched {
+		return fmt.Errorf("multiworld rule only matches dungeon items: %s",
+			pattern)
+	}
+	return fmt.Errorf("multiworld rule matches no items: %s", pattern)
+}
+
+// returns true iff the rules have any effect.
+func (rules multiRules) any() bool {
+	return len(rules.local) > 0 || len(rules.remote) > 0 ||
+		len(rules.noDungeons) > 0 || rules.rings || rules.shops
+}
+
+// returns true iff any of the patterns are substrings of the name.
+func matchesAnyItem(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if strings.Contains(name, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns true iff an item can be moved by the multiworld shuffle at all.
+func isMultiMovable(mrs []*multiRoute, item *node) bool {
+	return (!strings.Contains(item.name, " ring") ||
+		mrs[item.player-1].rules.rings) && !staysInOwnGame(item.name)
+}
+
+// returns true iff an item is never moved by the multiworld shuffle,
+// regardless of rules. dungeon items stay where they are since dungeon logic
+// is done per player.
+func staysInOwnGame(name string) bool {
+	return strings.HasSuffix(name, "small key") ||
+		strings.HasSuffix(name, "boss key") ||
+		strings.HasSuffix(name, "dungeon map") ||
+		strings.HasSuffix(name, "compass") ||
+		name == "slate"
 }
 
 // returns true iff a given slot/item can be multiworld shuffled
-func isMultiEligible(mr *multiRoute, slot, item *node) bool {
-	return !mr.local[slot] && !strings.Contains(item.name, " ring") &&
-		!strings.HasSuffix(item.name, "small key") &&
-		!strings.HasSuffix(item.name, "boss key") &&
-		!strings.HasSuffix(item.name, "dungeon map") &&
-		!strings.HasSuffix(item.name, "compass") &&
-		item.name != "slate"
+func isMultiEligible(mrs []*multiRoute, slot, item *node) bool {
+	return !mrs[slot.player-1].local[slot] && isMultiMovable(mrs, item)
+}
+
+// returns true iff the item's owner's rules allow it to be in the slot. this
+// doesn't check whether the item is movable or the slot is local.
+func multiRulesAllow(mrs []*multiRoute, slot, item *node) bool {
+	rules := mrs[item.player-1].rules
+	if slot.player == item.player {
+		return !matchesAnyItem(rules.remote, item.name)
+	}
+	if matchesAnyItem(rules.local, item.name) {
+		return false
+	}
+	if getDungeonName(slot.name) != "" {
+		for _, player := range rules.noDungeons {
+			if player == slot.player {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// returns an error if any placement breaks its owner's rules.
+func checkMultiRules(mrs []*multiRoute) error {
+	for _, mr := range mrs {
+		for _, slot := range sortedMultiNodes(mr.checks) {
+			item := mr.checks[slot]
+			if !multiRulesAllow(mrs, slot, item) {
+				return fmt.Errorf("couldn't follow rules for P%d %s in P%d %s",
+					item.player, item.name, slot.player, slot.name)
+			}
+		}
+	}
+	return nil
+}
+
+// returns a set of slots that can only hold the player's own items. slots
+// that share a room with another slot are always local, since the owner of an
+// item is looked up by room.
+func getMultiLocalSlots(rom *romState, ri *routeInfo,
+	rules multiRules) map[*node]bool {
+	roomCounts := make(map[uint16]int)
+	for _, slot := range rom.itemSlots {
+		roomCounts[uint16(slot.group)<<8|uint16(slot.room)]++
+		for _, room := range slot.moreRooms {
+			roomCounts[room]++
+		}
+	}
+
+	local := make(map[*node]bool)
+	for name, slot := range rom.itemSlots {
+		node := ri.graph[name]
+		if node == nil {
+			continue
+		}
+		local[node] = slot.localOnly
+		if rules.shops && slot.localOnly && isShopSlot(name) &&
+			roomCounts[uint16(slot.group)<<8|uint16(slot.room)] == 1 &&
+			len(slot.moreRooms) == 0 {
+			local[node] = false
+		}
+	}
+	return local
+}
+
+func isShopSlot(name string) bool {
+	return strings.Contains(name, "shop") ||
+		strings.HasPrefix(name, "subrosia market")
 }
 
 // picks a random multiworld-eligible check from a route
-func randomMultiCheck(src *rand.Rand, mr *multiRoute) (*node, *node) {
+func randomMultiCheck(src *rand.Rand, mrs []*multiRoute,
+	mr *multiRoute) (*node, *node) {
 	i, slots := 0, make([]*node, 0, len(mr.checks))
 	for slot, item := range mr.checks {
-		if isMultiEligible(mr, slot, item) {
+		if isMultiEligible(mrs, slot, item) {
 			slots = append(slots, slot)
 			i++
 		}
@@ -42,12 +211,19 @@ func randomMultiCheck(src *rand.Rand, mr *multiRoute) (*node, *node) {
 	return slot, mr.checks[slot]
 }
 
-func shuffleMultiworld(
-	ris []*routeInfo, roms []*romState, verbose bool, logf logFunc) {
+// multiworld fill algorithms, for the -multifill flag.
+var multiFillModes = []string{"global", "swap"}
+
+// number of consecutive spheres a player can go without finding any of their
+// own checks before a multiworld placement is rejected.
+const multiDroughtLimit = 2
+
+// redistributes items between players' routes. each route must already have a
+// complete placement of its own.
+func shuffleMultiworld(ris []*routeInfo, roms []*romState,
+	rules []multiRules, mode string, crossFraction float64, verbose bool,
+	logf logFunc) error {
 	mrs := make([]*multiRoute, len(ris))
-	src := ris[0].src
-	swapCounts := make(map[*node]int)
-	swaps := 0
 
 	for i, ri := range ris {
 		// mark graph nodes as belonging to each player
@@ -59,11 +235,79 @@ func shuffleMultiworld(
 		mrs[i] = &multiRoute{
 			ri:     ri,
 			checks: getChecks(ri.usedItems, ri.usedSlots),
-			local:  make(map[*node]bool, ri.usedItems.Len()),
+			local:  getMultiLocalSlots(roms[i], ri, rules[i]),
+			rules:  rules[i],
+		}
+	}
+
+	switch mode {
+	case "swap":
+		swapMultiworld(mrs, roms, verbose, logf)
+		if err := checkMultiRules(mrs); err != nil {
+			return err
+		}
+	case "global":
+		if err := fillMultiworld(
+			mrs, roms, crossFraction, verbose, logf); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown multiworld fill mode: %s", mode)
+	}
+
+	// reconstruct used item and slot lists
+	setMultiRouteLists(mrs)
+	for i, ri := range ris {
+		for es := ri.usedSlots.Front(); es != nil; es = es.Next() {
+			slot := es.Value.(*node)
+			roms[i].itemSlots[slot.name].player =
+				byte(mrs[i].checks[slot].player)
+		}
+	}
+
+	return nil
+}
+
+// rebuilds each route's used item and slot lists from its check map.
+func setMultiRouteLists(mrs []*multiRoute) {
+	for _, mr := range mrs {
+		mr.ri.usedItems, mr.ri.usedSlots = list.New(), list.New()
+		for slot, item := range mr.checks {
+			mr.ri.usedItems.PushBack(item)
+			mr.ri.usedSlots.PushBack(slot)
 		}
-		for slot, item := range mrs[i].checks {
-			mrs[i].local[slot] = roms[i].itemSlots[slot.name].localOnly
-			if isMultiEligible(mrs[i], slot, item) {
+	}
+}
+
+// resets and explores all players' graphs, returning true iff every player
+// can finish.
+func exploreMultiworld(mrs []*multiRoute) bool {
+	for _, mr := range mrs {
+		mr.ri.graph.reset()
+	}
+	for _, mr := range mrs {
+		mr.ri.graph["start"].explore()
+	}
+	for _, mr := range mrs {
+		if !mr.ri.graph["done"].reached {
+			return false
+		}
+	}
+	return true
+}
+
+// shuffles items by making random swaps between players' existing
+// placements, keeping each swap that leaves every seed completable. this is
+// slow with many players and tends not to produce many cross-world items.
+func swapMultiworld(
+	mrs []*multiRoute, roms []*romState, verbose bool, logf logFunc) {
+	src := mrs[0].ri.src
+	swapCounts := make(map[*node]int)
+	swaps := 0
+
+	for _, mr := range mrs {
+		for slot, item := range mr.checks {
+			if isMultiEligible(mrs, slot, item) {
 				swapCounts[slot] = 0
 			}
 		}
@@ -72,17 +316,19 @@ func shuffleMultiworld(
 	// swap some random items ???
 	consecutiveMisses := 0
 	for consecutiveMisses < 1000 {
-		slot1, item1 := randomMultiCheck(src, mrs[src.Intn(len(mrs))])
-		slot2, item2 := randomMultiCheck(src, mrs[src.Intn(len(mrs))])
+		slot1, item1 := randomMultiCheck(src, mrs, mrs[src.Intn(len(mrs))])
+		slot2, item2 := randomMultiCheck(src, mrs, mrs[src.Intn(len(mrs))])
 
 		// skip if slots are from the same player, or either of the treasures
 		// aren't present in the other game, or the swapped treasures don't fit
-		// in their new slots
+		// in their new slots, or the owners' rules forbid it
 		if slot1.player == slot2.player ||
 			roms[slot1.player-1].treasures[item2.name] == nil ||
 			roms[slot2.player-1].treasures[item1.name] == nil ||
 			!itemFitsInSlot(item2, slot1) ||
-			!itemFitsInSlot(item1, slot2) {
+			!itemFitsInSlot(item1, slot2) ||
+			!multiRulesAllow(mrs, slot1, item2) ||
+			!multiRulesAllow(mrs, slot2, item1) {
 			continue
 		}
 
@@ -108,33 +354,16 @@ func shuffleMultiworld(
 		item2.addParent(slot1)
 
 		// test whether seeds are still beatable w/ item placement
-		success := true
-		for _, ri := range ris {
-			ri.graph.reset()
-		}
-		for _, ri := range ris {
-			ri.graph["start"].explore()
-		}
-		for _, ri := range ris {
-			if !ri.graph["done"].reached {
-				success = false
-				break
-			}
-		}
+		success := exploreMultiworld(mrs)
 
 		// make sure no player has to wait too long on progression from another
 		mrs[slot1.player-1].checks[slot1] = item2
 		mrs[slot2.player-1].checks[slot2] = item1
-		for i, ri := range ris {
-			ri.usedItems, ri.usedSlots = list.New(), list.New()
-			for slot, item := range mrs[i].checks {
-				ri.usedItems.PushBack(item)
-				ri.usedSlots.PushBack(slot)
-			}
-		}
+		setMultiRouteLists(mrs)
 		mrs[slot1.player-1].checks[slot1] = item1
 		mrs[slot2.player-1].checks[slot2] = item2
-		if playerHasConsecutiveEmptySpheres(ris, 2) {
+		if playerHasConsecutiveEmptySpheres(
+			multiRouteInfos(mrs), multiDroughtLimit) {
 			success = false
 		}
 
@@ -159,16 +388,172 @@ func shuffleMultiworld(
 	if verbose {
 		logf("made %d successful swaps", swaps)
 	}
+}
 
-	// reconstruct used item and slot lists
-	for i, ri := range ris {
-		ri.usedItems, ri.usedSlots = list.New(), list.New()
-		for slot, item := range mrs[i].checks {
-			ri.usedItems.PushBack(item)
-			ri.usedSlots.PushBack(slot)
-			roms[i].itemSlots[slot.name].player = byte(item.player)
+func multiRouteInfos(mrs []*multiRoute) []*routeInfo {
+	ris := make([]*routeInfo, len(mrs))
+	for i, mr := range mrs {
+		ris[i] = mr.ri
+	}
+	return ris
+}
+
+// an item or slot in the global multiworld fill pool.
+type multiCheck struct {
+	mr   *multiRoute
+	node *node
+}
+
+// fills all players' movable items into the combined graph at once, using
+// assumed fill: each progression item is placed in a slot that's reachable
+// assuming every progression item not yet placed is already owned. slots in
+// other players' games are preferred until the fraction of cross-world items
+// reaches crossFraction. local slots are part of the pool too, but only for
+// their own player's items. placements that give any player a long drought of
+// checks are rejected and the fill is retried.
+func fillMultiworld(mrs []*multiRoute, roms []*romState,
+	crossFraction float64, verbose bool, logf logFunc) error {
+	src := mrs[0].ri.src
+
+	// pull movable items out of their slots. the lists are sorted so that
+	// order isn't dependent on map implementation.
+	var items, slots []multiCheck
+	for _, mr := range mrs {
+		for _, slot := range sortedMultiNodes(mr.checks) {
+			item := mr.checks[slot]
+			if isMultiMovable(mrs, item) {
+				item.removeParent(slot)
+				delete(mr.checks, slot)
+				items = append(items, multiCheck{mr, item})
+				slots = append(slots, multiCheck{mr, slot})
+			}
+		}
+	}
+
+	for tries := 0; tries < maxTries; tries++ {
+		src.Shuffle(len(items), func(i, j int) {
+			items[i], items[j] = items[j], items[i]
+		})
+		src.Shuffle(len(slots), func(i, j int) {
+			slots[i], slots[j] = slots[j], slots[i]
+		})
+
+		if tryFillMultiworld(mrs, roms, items, slots, crossFraction) {
+			setMultiRouteLists(mrs)
+			if exploreMultiworld(mrs) && checkMultiRules(mrs) == nil &&
+				!playerHasConsecutiveEmptySpheres(
+					multiRouteInfos(mrs), multiDroughtLimit) {
+				if verbose {
+					logf("multiworld fill succeeded after %d tries", tries+1)
+				}
+				return nil
+			}
+		}
+		if verbose {
+			logf("multiworld fill failed; retrying")
+		}
+
+		// clear placements and try again
+		for _, slot := range slots {
+			if item := slot.mr.checks[slot.node]; item != nil {
+				item.removeParent(slot.node)
+				delete(slot.mr.checks, slot.node)
+			}
+		}
+	}
+
+	return fmt.Errorf("could not fill multiworld after %d tries", maxTries)
+}
+
+// places items in slots, returning false if an item can't be placed.
+// progression items go first, in the given order, then inert items.
+func tryFillMultiworld(mrs []*multiRoute, roms []*romState,
+	items, slots []multiCheck, crossFraction float64) bool {
+	var progression, inert []multiCheck
+	for _, item := range items {
+		if itemIsInert(roms[item.node.player-1].treasures, item.node.name) {
+			inert = append(inert, item)
+		} else {
+			progression = append(progression, item)
 		}
 	}
+
+	// assume all unplaced progression items are owned
+	for _, item := range progression {
+		item.node.addParent(item.mr.ri.graph["start"])
+	}
+
+	open := make([]multiCheck, len(slots))
+	copy(open, slots)
+	placed, cross := 0, 0
+
+	// returns the index of the slot to place an item in, or -1.
+	pickSlot := func(item multiCheck, mustReach bool) int {
+		wantCross := float64(cross) < crossFraction*float64(placed+1)
+		fallback := -1
+		for i, slot := range open {
+			if (mustReach && !slot.node.reached) ||
+				(slot.mr != item.mr && slot.mr.local[slot.node]) ||
+				roms[slot.node.player-1].treasures[item.node.name] == nil ||
+				!itemFitsInSlot(item.node, slot.node) ||
+				!multiRulesAllow(mrs, slot.node, item.node) {
+				continue
+			}
+			if (slot.mr != item.mr) == wantCross {
+				return i
+			}
+			if fallback == -1 {
+				fallback = i
+			}
+		}
+		return fallback
+	}
+
+	place := func(item multiCheck, i int) {
+		slot := open[i]
+		open = append(open[:i], open[i+1:]...)
+		item.node.addParent(slot.node)
+		slot.mr.checks[slot.node] = item.node
+		placed++
+		if slot.mr != item.mr {
+			cross++
+		}
+	}
+
+	for i, item := range progression {
+		item.node.removeParent(item.mr.ri.graph["start"])
+		exploreMultiworld(mrs)
+		j := pickSlot(item, true)
+		if j == -1 {
+			for _, item := range progression[i+1:] {
+				item.node.removeParent(item.mr.ri.graph["start"])
+			}
+			return false
+		}
+		place(item, j)
+	}
+
+	for _, item := range inert {
+		j := pickSlot(item, false)
+		if j == -1 {
+			return false
+		}
+		place(item, j)
+	}
+
+	return true
+}
+
+// returns the keys of a check map, sorted by name.
+func sortedMultiNodes(checks map[*node]*node) []*node {
+	nodes := make([]*node, 0, len(checks))
+	for slot := range checks {
+		nodes = append(nodes, slot)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].name < nodes[j].name
+	})
+	return nodes
 }
 
 // returns true iff any of the players have >= limit empty spheres *before*
@@ -0,0 +1,134 @@
+package randomizer
+
+import (
+	"container/list"
+	"math/rand"
+	"testing"
+)
+
+// returns a route and rom for a tiny game where "chest 1" is open, "chest 2"
+// and the goal require "key", and "junk" does nothing.
+func testMultiRoute(src *rand.Rand) (*routeInfo, *romState) {
+	g := newGraph()
+	for _, name := range []string{"start", "chest 1", "chest 2", "done"} {
+		g[name] = newNode(name, andNode)
+	}
+	for _, name := range []string{"key", "junk"} {
+		g[name] = newNode(name, orNode)
+	}
+	g.addParents(map[string][]string{
+		"chest 1": {"start"},
+		"chest 2": {"key"},
+		"done":    {"key"},
+	})
+
+	// vanilla placement
+	g["key"].addParent(g["chest 1"])
+	g["junk"].addParent(g["chest 2"])
+	ri := &routeInfo{
+		graph:     g,
+		slots:     map[string]*node{"chest 1": g["chest 1"], "chest 2": g["chest 2"]},
+		usedItems: list.New(),
+		usedSlots: list.New(),
+		src:       src,
+	}
+	ri.usedItems.PushBack(g["key"])
+	ri.usedSlots.PushBack(g["chest 1"])
+	ri.usedItems.PushBack(g["junk"])
+	ri.usedSlots.PushBack(g["chest 2"])
+
+	rom := &romState{
+		treasures: map[string]*treasure{
+			"key":  {id: 0x05},
+			"junk": {id: 0x29},
+		},
+		itemSlots: map[string]*itemSlot{
+			"chest 1": {},
+			"chest 2": {},
+		},
+	}
+
+	return ri, rom
+}
+
+// shuffles two test routes and returns the number of cross-world items.
+func testFillMultiworld(t *testing.T, seed int64, fraction float64,
+	rules multiRules) int {
+	t.Helper()
+	src := rand.New(rand.NewSource(seed))
+	ri1, rom1 := testMultiRoute(src)
+	ri2, rom2 := testMultiRoute(src)
+	ris := []*routeInfo{ri1, ri2}
+
+	if err := shuffleMultiworld(ris, []*romState{rom1, rom2},
+		[]multiRules{rules, rules}, "global", fraction, false,
+		nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// both players can finish
+	for _, ri := range ris {
+		ri.graph.reset()
+	}
+	for _, ri := range ris {
+		ri.graph["start"].explore()
+	}
+	testExpect(t, ri1.graph["done"].reached, true)
+	testExpect(t, ri2.graph["done"].reached, true)
+
+	cross := 0
+	for _, ri := range ris {
+		checks := getChecks(ri.usedItems, ri.usedSlots)
+		testExpect(t, len(checks), 2)
+		for slot, item := range checks {
+			if slot.player != item.player {
+				cross++
+				if rules.local != nil {
+					testExpect(t, item.name, "junk")
+				}
+			} else if rules.remote != nil {
+				testExpect(t, item.name, "junk")
+			}
+		}
+	}
+	return cross
+}
+
+func TestFillMultiworld(t *testing.T) {
+	for seed := int64(0); seed < 10; seed++ {
+		// every item is local or every item is cross-world
+		testExpect(t, testFillMultiworld(t, seed, 0, multiRules{}), 0)
+		testExpect(t, testFillMultiworld(t, seed, 1, multiRules{}), 4)
+
+		// rules take precedence over the target fraction
+		testExpect(t, testFillMultiworld(t, seed, 0,
+			multiRules{remote: []string{"key"}}), 2)
+		testExpect(t, testFillMultiworld(t, seed, 1,
+			multiRules{local: []string{"key"}}), 2)
+	}
+}
+
+func TestParseMultiRules(t *testing.T) {
+	ropts := &randomizerOptions{}
+	testExpect(t, roptsFromString(
+		"s+hd/local=sword.feather/remote=flute/nodungeons=3/rings",
+		ropts), nil)
+	testExpect(t, ropts.hard && ropts.dungeons, true)
+	testExpect(t, ropts.multi, multiRules{
+		local:      []string{"sword", "feather"},
+		remote:     []string{"flute"},
+		noDungeons: []int{3},
+		rings:      true,
+	})
+
+	testExpect(t, roptsFromString("a/shop", ropts) != nil, true)
+	testExpect(t, roptsFromString("a/nodungeons=x", ropts) != nil, true)
+
+	// patterns need to match items that can move between games
+	testExpect(t, roptsFromString("s/local=small key", ropts) != nil, true)
+	testExpect(t, roptsFromString("a/remote=slate", ropts) != nil, true)
+	testExpect(t, roptsFromString("s/remote=hookshot", ropts) != nil, true)
+	testExpect(t, roptsFromString("s/local=", ropts) != nil, true)
+	testExpect(t, roptsFromString("s/remote=key", ropts), nil)
+	testExpect(t, roptsFromString("s/remote=ring", ropts), nil)
+}
@@ -0,0 +1,340 @@
+package randomizer
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// implements -devcmd multiserver: a TCP relay that passes multiworld items
+// between players' emulators, as an alternative to bizhawk co-op netplay.
+//
+// the protocol is line-based. a client sends "hello <player> <rom sha1>
+// <items received>" on connecting, and the server replies "ok" or "error
+// <message>". after that, the client sends "send <group/room> <id> <param>"
+// whenever the player finds an item for another player, and the server sends
+// "item <index> <from> <group/room> <id> <param>" for each item the client's
+// player is owed, starting at the received count from the hello line. rooms,
+// IDs, and params are hex; everything else is decimal.
+//
+// the owner of an item is looked up in the sender's collect properties table,
+// not taken from the client, and each item is only added to the owner's inbox
+// once. inboxes are saved to disk after every change, so that the server can
+// be restarted and clients can reconnect without losing items.
+
+// a multiworld participant, as read from a generated ROM.
+type serverPlayer struct {
+	game   int
+	hash   string         // sha1 of ROM, uppercase hex
+	owners map[uint16]int // group/room -> player number
+}
+
+// an item in transit from one player to another.
+type relayItem struct {
+	From  int
+	Room  uint16
+	ID    byte
+	Param byte
+}
+
+// the part of the server state that's saved to disk.
+type relayState struct {
+	Hashes  map[int]string
+	Inboxes map[int][]relayItem
+}
+
+type multiServer struct {
+	mu      sync.Mutex
+	players map[int]*serverPlayer
+	state   relayState
+	path    string                // state file
+	conns   map[int]*bufio.Writer // connected clients
+	logf    logFunc
+}
+
+// reads a generated multiworld ROM and returns its player number and info.
+func loadServerPlayer(filename string) (int, *serverPlayer, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var game int
+	switch {
+	case romIsSeasons(b):
+		game = gameSeasons
+	case romIsAges(b):
+		game = gameAges
+	default:
+		return 0, nil, fmt.Errorf("%s is not an oracles ROM", filename)
+	}
+
+	// table addresses don't depend on the seed, so a ROM state without data
+	// is good enough to find them.
+	rom := newRomState(nil, game, 1, nil)
+	player := int(b[rom.codeMutables["multiPlayerNumber"].addr.fullOffset()])
+	if player == 0 {
+		return 0, nil, fmt.Errorf("%s is not a multiworld ROM", filename)
+	}
+
+	sp := &serverPlayer{
+		game:   game,
+		hash:   fmt.Sprintf("%X", sha1.Sum(b)),
+		owners: make(map[uint16]int),
+	}
+	table := rom.codeMutables["collectPropertiesTable"].addr.fullOffset()
+	for i := table; b[i] != 0xff; i += 4 {
+		sp.owners[uint16(b[i])<<8|uint16(b[i+1])] = int(b[i+3])
+	}
+
+	return player, sp, nil
+}
+
+// returns a server for the given players, loading saved state from the given
+// path if it exists.
+func newMultiServer(players map[int]*serverPlayer, path string,
+	logf logFunc) (*multiServer, error) {
+	s := &multiServer{
+		players: players,
+		state: relayState{
+			Hashes:  make(map[int]string),
+			Inboxes: make(map[int][]relayItem),
+		},
+		path:  path,
+		conns: make(map[int]*bufio.Writer),
+		logf:  logf,
+	}
+	for n, p := range players {
+		s.state.Hashes[n] = p.hash
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var saved relayState
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return nil, err
+	}
+	for n, hash := range s.state.Hashes {
+		if saved.Hashes[n] != hash {
+			return nil, fmt.Errorf("%s is for a different seed", path)
+		}
+	}
+	s.state.Inboxes = saved.Inboxes
+	if s.state.Inboxes == nil {
+		s.state.Inboxes = make(map[int][]relayItem)
+	}
+	logf("loaded relay state from %s", path)
+
+	return s, nil
+}
+
+// accepts connections until the listener is closed.
+func (s *multiServer) serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handleConn(conn)
+	}
+}
+
+// handles one client connection until it closes.
+func (s *multiServer) handleConn(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	w := bufio.NewWriter(conn)
+
+	// handshake
+	if !scanner.Scan() {
+		return
+	}
+	player, count, err := s.checkHello(scanner.Text())
+	if err != nil {
+		fmt.Fprintf(w, "error %v\n", err)
+		w.Flush()
+		s.logf("rejected client %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+
+	s.mu.Lock()
+	if old := s.conns[player]; old != nil {
+		s.logf("P%d reconnected; dropping old connection", player)
+	}
+	s.conns[player] = w
+	fmt.Fprintf(w, "ok\n")
+	inbox := s.state.Inboxes[player]
+	for i := count; i < len(inbox); i++ {
+		writeRelayItem(w, i, inbox[i])
+	}
+	w.Flush()
+	s.mu.Unlock()
+	s.logf("P%d connected from %s; %d items owed", player,
+		conn.RemoteAddr(), len(inbox))
+
+	for scanner.Scan() {
+		if err := s.handleLine(player, scanner.Text()); err != nil {
+			s.logf("P%d: %v", player, err)
+		}
+	}
+
+	s.mu.Lock()
+	if s.conns[player] == w {
+		delete(s.conns, player)
+	}
+	s.mu.Unlock()
+	s.logf("P%d disconnected", player)
+}
+
+// parses and validates a hello line, returning player number and number of
+// items the client has already received.
+func (s *multiServer) checkHello(line string) (int, int, error) {
+	a := strings.Fields(line)
+	if len(a) != 4 || a[0] != "hello" {
+		return 0, 0, fmt.Errorf("expected hello, got %q", line)
+	}
+	player, err := strconv.Atoi(a[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad player number: %s", a[1])
+	}
+	p := s.players[player]
+	if p == nil {
+		return 0, 0, fmt.Errorf("no such player: %d", player)
+	}
+	if !strings.EqualFold(a[2], p.hash) {
+		return 0, 0, fmt.Errorf("ROM hash doesn't match P%d", player)
+	}
+	count, err := strconv.Atoi(a[3])
+	if err != nil || count < 0 {
+		return 0, 0, fmt.Errorf("bad item count: %s", a[3])
+	}
+	return player, count, nil
+}
+
+// handles a line from a connected client.
+func (s *multiServer) handleLine(player int, line string) error {
+	a := strings.Fields(line)
+	if len(a) == 0 {
+		return nil
+	}
+	if a[0] != "send" || len(a) != 4 {
+		return fmt.Errorf("bad message: %q", line)
+	}
+
+	var v [3]uint64
+	for i, bitSize := range []int{16, 8, 8} {
+		var err error
+		if v[i], err = strconv.ParseUint(a[i+1], 16, bitSize); err != nil {
+			return fmt.Errorf("bad message: %q", line)
+		}
+	}
+	item := relayItem{
+		From:  player,
+		Room:  uint16(v[0]),
+		ID:    byte(v[1]),
+		Param: byte(v[2]),
+	}
+
+	return s.deliver(item)
+}
+
+// adds an item to its owner's inbox, if it isn't there already, and sends it
+// if the owner is connected.
+func (s *multiServer) deliver(item relayItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	owner, ok := s.players[item.From].owners[item.Room]
+	if !ok {
+		return fmt.Errorf("no item slot in room %04x", item.Room)
+	}
+	if owner == item.From || s.players[owner] == nil {
+		return fmt.Errorf("item in room %04x isn't for another player",
+			item.Room)
+	}
+
+	for _, prev := range s.state.Inboxes[owner] {
+		if prev.From == item.From && prev.Room == item.Room {
+			return nil // already relayed
+		}
+	}
+	s.state.Inboxes[owner] = append(s.state.Inboxes[owner], item)
+	if err := s.save(); err != nil {
+		return err
+	}
+	s.logf("P%d -> P%d: {%02x, %02x}", item.From, owner, item.ID, item.Param)
+
+	if w := s.conns[owner]; w != nil {
+		writeRelayItem(w, len(s.state.Inboxes[owner])-1, item)
+		w.Flush()
+	}
+	return nil
+}
+
+// writes the server state to disk. the caller must hold the lock.
+func (s *multiServer) save() error {
+	b, err := json.Marshal(s.state)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func writeRelayItem(w *bufio.Writer, index int, item relayItem) {
+	fmt.Fprintf(w, "item %d %d %04x %02x %02x\n",
+		index, item.From, item.Room, item.ID, item.Param)
+}
+
+// runs the relay for the given generated ROMs on the given address.
+func runMultiServer(addr string, filenames []string, logf logFunc) error {
+	if len(filenames) < 2 {
+		return fmt.Errorf("multiserver needs at least two ROMs")
+	}
+
+	players := make(map[int]*serverPlayer)
+	hashes := make([]string, 0, len(filenames))
+	for _, filename := range filenames {
+		n, p, err := loadServerPlayer(filename)
+		if err != nil {
+			return err
+		}
+		if players[n] != nil {
+			return fmt.Errorf("multiple ROMs for P%d", n)
+		}
+		players[n] = p
+		hashes = append(hashes, p.hash)
+		logf("P%d: %s (%s)", n, filename, gameNames[p.game])
+	}
+
+	// name the state file after the seed, regardless of ROM order
+	sort.Strings(hashes)
+	sum := sha1.Sum([]byte(strings.Join(hashes, "")))
+	path := fmt.Sprintf("multiserver_%x.json", sum[:4])
+	s, err := newMultiServer(players, path, logf)
+	if err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	logf("listening on %s", l.Addr())
+	return s.serve(l)
+}
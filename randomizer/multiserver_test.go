@@ -0,0 +1,114 @@
+package randomizer
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a stand-in for Oracles.lua in relay mode.
+type fakeRelayClient struct {
+	conn    net.Conn
+	scanner *bufio.Scanner
+}
+
+func dialRelay(t *testing.T, addr string, player int, hash string,
+	count int) *fakeRelayClient {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &fakeRelayClient{conn: conn, scanner: bufio.NewScanner(conn)}
+	fmt.Fprintf(conn, "hello %d %s %d\n", player, hash, count)
+	return c
+}
+
+// returns the next line from the server, or "" on timeout or close.
+func (c *fakeRelayClient) readLine() string {
+	c.conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	if c.scanner.Scan() {
+		return c.scanner.Text()
+	}
+	return ""
+}
+
+func startTestRelay(t *testing.T, path string) (*multiServer, net.Listener) {
+	players := map[int]*serverPlayer{
+		1: {game: gameSeasons, hash: "AAAA", owners: map[uint16]int{
+			0x0012: 2, 0x0034: 1}},
+		2: {game: gameAges, hash: "BBBB", owners: map[uint16]int{
+			0x0056: 1}},
+	}
+	s, err := newMultiServer(players, path, func(string, ...interface{}) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.serve(l)
+	return s, l
+}
+
+func TestMultiServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "multiserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	_, l := startTestRelay(t, path)
+	addr := l.Addr().String()
+
+	// wrong hash is rejected
+	bad := dialRelay(t, addr, 1, "BBBB", 0)
+	testExpect(t, strings.HasPrefix(bad.readLine(), "error"), true)
+	bad.conn.Close()
+
+	p1 := dialRelay(t, addr, 1, "aaaa", 0)
+	testExpect(t, p1.readLine(), "ok")
+	p2 := dialRelay(t, addr, 2, "BBBB", 0)
+	testExpect(t, p2.readLine(), "ok")
+
+	// item goes to the owner in the table, and only once
+	fmt.Fprintf(p1.conn, "send 0012 05 00\n")
+	fmt.Fprintf(p1.conn, "send 0012 05 00\n")
+	testExpect(t, p2.readLine(), "item 0 1 0012 05 00")
+	testExpect(t, p2.readLine(), "")
+
+	// local items aren't relayed
+	fmt.Fprintf(p1.conn, "send 0034 06 00\n")
+	fmt.Fprintf(p2.conn, "send 0056 07 01\n")
+	testExpect(t, p1.readLine(), "item 0 2 0056 07 01")
+	testExpect(t, p1.readLine(), "")
+
+	// reconnecting resends items past the given count
+	p2.conn.Close()
+	p2 = dialRelay(t, addr, 2, "BBBB", 0)
+	testExpect(t, p2.readLine(), "ok")
+	testExpect(t, p2.readLine(), "item 0 1 0012 05 00")
+	p2.conn.Close()
+	p2 = dialRelay(t, addr, 2, "BBBB", 1)
+	testExpect(t, p2.readLine(), "ok")
+	testExpect(t, p2.readLine(), "")
+
+	p1.conn.Close()
+	p2.conn.Close()
+	l.Close()
+
+	// state survives a server restart
+	_, l = startTestRelay(t, path)
+	defer l.Close()
+	p2 = dialRelay(t, l.Addr().String(), 2, "BBBB", 0)
+	defer p2.conn.Close()
+	testExpect(t, p2.readLine(), "ok")
+	testExpect(t, p2.readLine(), "item 0 1 0012 05 00")
+}
@@ -5,8 +5,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math/rand"
-	"os"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -16,41 +16,108 @@ import (
 type plan struct {
 	source   string
 	items    map[string]string
+	owners   map[string]int    // slot -> player, for multiworld items
+	sent     map[string]string // "P2 slot" -> item owned by this player
 	dungeons map[string]string
 	portals  map[string]string
+	returns  map[string]string
+	mixed    map[string]string
 	seasons  map[string]string
+	animal   map[string]string
 	hints    map[string]string
 }
 
 func newPlan() *plan {
 	return &plan{
 		items:    make(map[string]string),
+		owners:   make(map[string]int),
+		sent:     make(map[string]string),
 		dungeons: make(map[string]string),
 		portals:  make(map[string]string),
+		returns:  make(map[string]string),
+		mixed:    make(map[string]string),
 		seasons:  make(map[string]string),
+		animal:   make(map[string]string),
 		hints:    make(map[string]string),
 	}
 }
 
-var conditionRegexp = regexp.MustCompile(`(.+?) +<- (.+)`)
+var (
+	conditionRegexp = regexp.MustCompile(`(.+?) +<- (.+)`)
+	multiItemRegexp = regexp.MustCompile(`^P(\d+) (.+?) +<- P(\d+) (.+)`)
+)
 
 // loads conditions from a file in spoiler log format.
 func parseSummary(path string, game int) (*plan, error) {
-	f, err := os.Open(path)
+	plans, err := parseMultiSummary([]string{path}, []int{game})
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
+	return plans[0], nil
+}
 
-	b, err := ioutil.ReadAll(f)
-	if err != nil {
-		return nil, err
+// loads conditions from multiworld spoiler logs, one per player, and returns
+// one plan per player. item lines are qualified by player, like "P1 slot <- P2
+// item", and can be in any of the logs; other sections apply to the player
+// whose log they're in.
+func parseMultiSummary(paths []string, games []int) ([]*plan, error) {
+	if len(paths) != len(games) {
+		return nil, fmt.Errorf("need one plan file per player")
+	}
+
+	plans := make([]*plan, len(games))
+	for i := range plans {
+		plans[i] = newPlan()
+	}
+	for i, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		plans[i].source = string(b)
+		if err := parsePlanText(string(b), i+1, games, plans); err != nil {
+			return nil, err
+		}
+	}
+
+	return plans, nil
+}
+
+// adds multiworld item line to the plans. lines are repeated across players'
+// logs, so the same line can be added more than once.
+func addMultiPlanItem(submatches []string, games []int, plans []*plan) error {
+	var players [2]int
+	for i, s := range []string{submatches[1], submatches[3]} {
+		player, err := strconv.Atoi(s)
+		if err != nil || player < 1 || player > len(plans) {
+			return fmt.Errorf("no such player: P%s", s)
+		}
+		players[i] = player
 	}
+	p := plans[players[0]-1]
+	slot := ungetNiceName(submatches[2], games[players[0]-1])
+	item := ungetNiceName(submatches[4], games[players[1]-1])
 
-	p := newPlan()
-	p.source = string(b)
+	if prev, ok := p.items[slot]; ok &&
+		(prev != item || p.owners[slot] != players[1]) {
+		return fmt.Errorf("conflicting items for P%d %s", players[0], slot)
+	}
+	p.items[slot] = item
+	p.owners[slot] = players[1]
+	if players[0] != players[1] {
+		plans[players[1]-1].sent[fmt.Sprintf("P%d %s", players[0], slot)] =
+			item
+	}
+
+	return nil
+}
+
+// parses spoiler log text into the plans. unqualified lines go in the plan for
+// the given player.
+func parsePlanText(text string, player int, games []int, plans []*plan) error {
+	p, game := plans[player-1], games[player-1]
 	section := p.items
-	for _, line := range strings.Split(string(b), "\n") {
+	for _, line := range strings.Split(text, "\n") {
 		line = strings.Replace(line, "\r", "", 1)
 		if strings.HasPrefix(line, "--") {
 			switch line {
@@ -61,12 +128,27 @@ func parseSummary(path string, game int) (*plan, error) {
 				section = p.dungeons
 			case "-- subrosia portals --":
 				section = p.portals
+			case "-- subrosia portal exits --":
+				section = p.returns
+			case "-- dungeons and portals --":
+				section = p.mixed
 			case "-- default seasons --":
 				section = p.seasons
+			case "-- animal companion --":
+				section = p.animal
 			case "-- hints --":
 				section = p.hints
+			case "-- multiworld rules --", "-- playthrough --",
+				"-- metrics --", "-- starting items --":
+				// informational only
+				section = make(map[string]string)
 			default:
-				return nil, fmt.Errorf("unknown section: %q", line)
+				return fmt.Errorf("unknown section: %q", line)
+			}
+		} else if submatches := multiItemRegexp.FindStringSubmatch(
+			line); submatches != nil {
+			if err := addMultiPlanItem(submatches, games, plans); err != nil {
+				return err
 			}
 		} else {
 			submatches := conditionRegexp.FindStringSubmatch(line)
@@ -88,7 +170,7 @@ func parseSummary(path string, game int) (*plan, error) {
 		}
 	}
 
-	return p, nil
+	return nil
 }
 
 // like findRoute, but uses a specified configuration instead of a random one.
@@ -104,7 +186,10 @@ func makePlannedRoute(rom *romState, p *plan) (*routeInfo, error) {
 
 	// must init rings before item placement
 	ringValues := make([]string, 0)
-	for _, item := range p.items {
+	for slot, item := range p.items {
+		if owner, ok := p.owners[slot]; ok && owner != rom.player {
+			continue
+		}
 		if strings.Contains(item, " ring") {
 			ringValues = append(ringValues, item)
 		}
@@ -114,9 +199,20 @@ func makePlannedRoute(rom *romState, p *plan) (*routeInfo, error) {
 		return nil, err
 	}
 
-	// item slots
+	// item slots. multiworld items owned by other players are added by
+	// linkPlannedMultiworld, but this player's items in other players' slots
+	// still determine the companion.
 	fluteSet := false // error if different flutes are given
+	for _, item := range orderedValues(p.sent) {
+		if err := ri.setPlannedFlute(item, &fluteSet); err != nil {
+			return nil, err
+		}
+	}
 	for slot, item := range p.items {
+		if owner, ok := p.owners[slot]; ok && owner != rom.player {
+			continue
+		}
+
 		// use original ring names
 		if ringName, ok := reverseLookup(ringMap, item); ok {
 			item = ringName.(string)
@@ -129,7 +225,10 @@ func makePlannedRoute(rom *romState, p *plan) (*routeInfo, error) {
 		if _, ok := ri.graph[slot]; !ok {
 			return nil, fmt.Errorf("no such check: %s", slot)
 		}
-		ri.graph[item] = newNode(item, orNode)
+		// keep existing item nodes, since logic depends on them
+		if ri.graph[item] == nil {
+			ri.graph[item] = newNode(item, orNode)
+		}
 		if !itemFitsInSlot(ri.graph[item], ri.graph[slot]) {
 			return nil, fmt.Errorf("%s doesn't fit in %s", item, slot)
 		}
@@ -137,23 +236,26 @@ func makePlannedRoute(rom *romState, p *plan) (*routeInfo, error) {
 		ri.usedItems.PushBack(ri.graph[item])
 		ri.usedSlots.PushBack(ri.graph[slot])
 
-		// set flute if applicable
-		if strings.HasSuffix(item, "flute") {
-			prevCompanion := ri.companion
-			switch item {
-			case "ricky's flute":
-				ri.companion = ricky
-			case "dimitri's flute":
-				ri.companion = dimitri
-			case "moosh's flute":
-				ri.companion = moosh
-			}
-			if fluteSet && ri.companion != prevCompanion {
-				return nil, fmt.Errorf("can't have multiple types of flute")
-			}
-			fluteSet = true
+		if err := ri.setPlannedFlute(item, &fluteSet); err != nil {
+			return nil, err
+		}
+	}
+
+	// companion, if set explicitly
+	for k, v := range p.animal {
+		companion := getStringIndex(companionNames, v)
+		if k != "companion" {
+			return nil, fmt.Errorf("invalid animal companion line: %s", k)
+		}
+		if companion < ricky {
+			return nil, fmt.Errorf("no such animal companion: %s", v)
 		}
+		if fluteSet && ri.companion != companion {
+			return nil, fmt.Errorf("companion doesn't match flute")
+		}
+		ri.companion = companion
 	}
+	linkAnimalCompanion(ri.graph, rom.game, ri.companion)
 
 	// seasons
 	if rom.game == gameSeasons {
@@ -183,25 +285,257 @@ func makePlannedRoute(rom *romState, p *plan) (*routeInfo, error) {
 		ri.entrances[entrance] = dungeon
 	}
 
-	// portals
+	// portals. exits default to the reverse of entrances.
 	if rom.game == gameSeasons {
 		ri.portals = make(map[string]string, len(p.portals))
+		ri.portalExits = make(map[string]string, len(p.portals))
 		for portal, connect := range p.portals {
-			if _, ok := subrosianPortalNames[portal]; !ok {
-				return nil, fmt.Errorf("invalid holodrum portal: %s", portal)
-			}
-			if _, ok := reverseLookup(subrosianPortalNames, connect); !ok {
-				return nil, fmt.Errorf("invalid subrosia portal: %s", connect)
+			if err := checkPortalPair(portal, connect); err != nil {
+				return nil, err
 			}
 			ri.portals[portal] = connect
+			ri.portalExits[connect] = portal
+		}
+		for connect, portal := range p.returns {
+			if err := checkPortalPair(portal, connect); err != nil {
+				return nil, err
+			}
+			ri.portalExits[connect] = portal
 		}
-	} else if len(p.portals) != 0 {
+
+		// mixed dungeons and portals
+		if len(p.mixed) != 0 && (len(p.dungeons) != 0 || len(p.portals) != 0) {
+			return nil, fmt.Errorf(
+				"dungeons and portals can't be both mixed and separate")
+		}
+		for entrance, dest := range p.mixed {
+			entrance = strings.Replace(entrance, " entrance", "", 1)
+			for _, s := range []string{entrance, dest} {
+				if s == "d0" ||
+					getStringIndex(dungeonNames[rom.game], s) == -1 {
+					_, ok := subrosianPortalNames[strings.TrimSuffix(
+						s, " portal")]
+					if !ok || !strings.HasSuffix(s, " portal") {
+						return nil, fmt.Errorf("no such warp: %s", s)
+					}
+				}
+			}
+			ri.entrances[entrance] = dest
+		}
+	} else if len(p.portals) != 0 || len(p.returns) != 0 ||
+		len(p.mixed) != 0 {
 		return nil, fmt.Errorf("ages doesn't have subrosia portals")
 	}
 
+	ri.linkPlannedWorld(rom.game)
+
 	return ri, nil
 }
 
+// connects default seasons, dungeon entrances, and portals in a planned route's
+// graph, the same way that findRoute does. anything that the plan doesn't
+// specify is vanilla.
+func (ri *routeInfo) linkPlannedWorld(game int) {
+	g := ri.graph
+	dungeons := getShuffledDungeons(g, game, randomizerOptions{
+		dungeons: len(ri.entrances) > 0,
+	})
+
+	if game == gameSeasons {
+		seasons := make(map[string]byte, len(seasonAreas))
+		for _, area := range seasonAreas {
+			if id, ok := ri.seasons[area]; ok {
+				seasons[area] = id
+			} else {
+				seasons[area] = byte(
+					getStringIndex(seasonsById, vanillaSeasons[area]))
+			}
+		}
+		linkSeasons(g, seasons)
+	}
+
+	if warpsMixed(ri.entrances) {
+		names := append([]string{}, dungeons...)
+		for _, portal := range holodrumPortalNames {
+			names = append(names, portal+" portal")
+		}
+		for _, entrance := range names {
+			dest, ok := ri.entrances[entrance]
+			if !ok {
+				dest = entrance
+			}
+			linkMixedWarp(g, entrance, dest)
+		}
+	} else {
+		entrances := make(map[string]string, len(dungeons))
+		for _, entrance := range dungeons {
+			entrances[entrance] = entrance
+			if dungeon, ok := ri.entrances[entrance]; ok {
+				entrances[entrance] = dungeon
+			}
+		}
+		linkDungeonEntrances(g, entrances)
+
+		if game == gameSeasons {
+			portals := make(map[string]string, len(holodrumPortalNames))
+			exits := make(map[string]string, len(holodrumPortalNames))
+			for _, portal := range holodrumPortalNames {
+				portals[portal] = subrosianPortalNames[portal]
+				exits[subrosianPortalNames[portal]] = portal
+			}
+			for k, v := range ri.portals {
+				portals[k] = v
+			}
+			for k, v := range ri.portalExits {
+				exits[k] = v
+			}
+			linkPortals(g, portals, exits)
+		}
+	}
+}
+
+// explores a plan's route and logs its spheres, including checks that can't
+// be reached. returns true iff the plan can be beaten.
+func checkPlan(rom *romState, p *plan, hard bool,
+	logf logFunc) (bool, error) {
+	ri, err := makePlannedRoute(rom, p)
+	if err != nil {
+		return false, err
+	}
+	if hard {
+		ri.graph["hard"].addParent(ri.graph["start"])
+	}
+	return checkPlannedRoute(ri, rom.game, logf), nil
+}
+
+// does the work of checkPlan after the route is made.
+func checkPlannedRoute(ri *routeInfo, game int, logf logFunc) bool {
+	g, checks, spheres, extra := getAllSpheres([]*routeInfo{ri})
+	ri.graph.reset()
+	g.reset()
+	g["start"].explore()
+	beatable := g["done"].reached
+
+	summary := make(chan string)
+	done := make(chan bool)
+	go func() {
+		for line := range summary {
+			logf("%s", line)
+		}
+		done <- true
+	}()
+	logSpheres(summary, checks, spheres, extra, []int{game}, nil)
+	close(summary)
+	<-done
+
+	unreachable := 0
+	for _, n := range extra {
+		if checks[n] != nil {
+			unreachable++
+		}
+	}
+	logf("")
+	if beatable {
+		logf("plan is beatable; %d unreachable checks.", unreachable)
+	} else {
+		logf("plan is not beatable; %d unreachable checks.", unreachable)
+	}
+
+	ri.graph["start"].removeParent(g["start"])
+	g["done"].removeParent(ri.graph["done"])
+	return beatable
+}
+
+// sets the companion if the item is a flute, returning an error if a different
+// flute has already been set.
+func (ri *routeInfo) setPlannedFlute(item string, fluteSet *bool) error {
+	if strings.HasSuffix(item, "flute") {
+		prevCompanion := ri.companion
+		switch item {
+		case "ricky's flute":
+			ri.companion = ricky
+		case "dimitri's flute":
+			ri.companion = dimitri
+		case "moosh's flute":
+			ri.companion = moosh
+		}
+		if *fluteSet && ri.companion != prevCompanion {
+			return fmt.Errorf("can't have multiple types of flute")
+		}
+		*fluteSet = true
+	}
+	return nil
+}
+
+// adds planned multiworld items to the graphs of the players they belong to,
+// and sets the owners of all slots.
+func linkPlannedMultiworld(
+	routes []*routeInfo, roms []*romState, plans []*plan) error {
+	for i, ri := range routes {
+		for _, v := range ri.graph {
+			v.player = i + 1
+		}
+		for e := ri.usedItems.Front(); e != nil; e = e.Next() {
+			e.Value.(*node).player = i + 1
+		}
+	}
+
+	for i, p := range plans {
+		ri := routes[i]
+		for _, slot := range orderedKeys(p.items) {
+			owner := p.owners[slot]
+			if owner == 0 || owner == i+1 {
+				continue
+			}
+			item := p.items[slot]
+
+			for _, rom := range []*romState{roms[i], roms[owner-1]} {
+				if _, ok := rom.treasures[item]; !ok {
+					return fmt.Errorf("no such item in %s: %s",
+						gameNames[rom.game], item)
+				}
+			}
+			if _, ok := ri.graph[slot]; !ok {
+				return fmt.Errorf("no such check: %s", slot)
+			}
+			itemNode := routes[owner-1].graph[item]
+			if itemNode == nil {
+				itemNode = newNode(item, orNode)
+				itemNode.player = owner
+				routes[owner-1].graph[item] = itemNode
+			}
+			if !itemFitsInSlot(itemNode, ri.graph[slot]) {
+				return fmt.Errorf("%s doesn't fit in %s", item, slot)
+			}
+			itemNode.addParent(ri.graph[slot])
+			ri.usedItems.PushBack(itemNode)
+			ri.usedSlots.PushBack(ri.graph[slot])
+		}
+	}
+
+	for i, ri := range routes {
+		es := ri.usedSlots.Front()
+		for ei := ri.usedItems.Front(); ei != nil; ei = ei.Next() {
+			slot := es.Value.(*node)
+			roms[i].itemSlots[slot.name].player = byte(ei.Value.(*node).player)
+			es = es.Next()
+		}
+	}
+
+	return nil
+}
+
+// returns an error if the given names aren't a holodrum and subrosia portal.
+func checkPortalPair(holodrum, subrosia string) error {
+	if _, ok := subrosianPortalNames[holodrum]; !ok {
+		return fmt.Errorf("invalid holodrum portal: %s", holodrum)
+	}
+	if _, ok := reverseLookup(subrosianPortalNames, subrosia); !ok {
+		return fmt.Errorf("invalid subrosia portal: %s", subrosia)
+	}
+	return nil
+}
+
 // overwrites regular owl hints with planned ones.
 func planOwlHints(p *plan, h *hinter, owlHints map[string]string) error {
 	// sanity check first
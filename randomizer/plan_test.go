@@ -0,0 +1,129 @@
+package randomizer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseMultiSummary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	items := "-- items --\n\n" +
+		"sphere 0:\n" +
+		"P1 maku tree                   <- P2 switch hook\n" +
+		"P1 horon village SW chest      <- P1 sword\n" +
+		"P2 maku tree                   <- P1 ricky's flute\n"
+	texts := []string{
+		items + "\n-- default seasons --\n\nnorth horon     <- winter\n",
+		items + "\n-- animal companion --\n\ncompanion <- moosh\n",
+		items + "P1 maku tree <- P1 sword\n",
+	}
+	paths := make([]string, len(texts))
+	for i, text := range texts {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("log%d.txt", i))
+		if err := ioutil.WriteFile(paths[i], []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plans, err := parseMultiSummary(
+		paths[:2], []int{gameSeasons, gameAges})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testExpect(t, plans[0].items["maku tree"], "switch hook")
+	testExpect(t, plans[0].owners["maku tree"], 2)
+	testExpect(t, plans[0].owners["horon village SW chest"], 1)
+	testExpect(t, plans[0].sent, map[string]string{
+		"P2 maku tree": "ricky's flute"})
+	testExpect(t, plans[0].seasons["north horon"], "winter")
+	testExpect(t, plans[1].items["maku tree"], "ricky's flute")
+	testExpect(t, plans[1].owners["maku tree"], 1)
+	testExpect(t, plans[1].animal["companion"], "moosh")
+	testExpect(t, len(plans[1].seasons), 0)
+
+	// conflicting lines, wrong number of files, and nonexistent players
+	_, err = parseMultiSummary(
+		[]string{paths[0], paths[2]}, []int{gameSeasons, gameAges})
+	testExpect(t, err != nil, true)
+	_, err = parseMultiSummary(paths[:1], []int{gameSeasons, gameAges})
+	testExpect(t, err != nil, true)
+	_, err = parseMultiSummary(paths[:1], []int{gameSeasons})
+	testExpect(t, err != nil, true)
+}
+
+// returns a rom state with item slots and treasures, but without asm, which
+// needs the assembler.
+func newTestRomState(game int) *romState {
+	rom := &romState{game: game, player: 1,
+		treasures: loadTreasures(nil, game)}
+	rom.itemSlots = rom.loadSlots()
+	return rom
+}
+
+// returns a plan that reproduces a route, as if it were written by hand from
+// the route's log.
+func routePlan(ri *routeInfo) *plan {
+	p := newPlan()
+	for es, ei := ri.usedSlots.Front(), ri.usedItems.Front(); es != nil; es,
+		ei = es.Next(), ei.Next() {
+		p.items[es.Value.(*node).name] = ei.Value.(*node).name
+	}
+	for area, id := range ri.seasons {
+		p.seasons[area] = seasonsById[id]
+	}
+	for entrance, dungeon := range ri.entrances {
+		p.dungeons[entrance+" entrance"] = dungeon
+	}
+	for holodrum, subrosia := range ri.portals {
+		p.portals[holodrum] = subrosia
+	}
+	p.animal["companion"] = companionNames[ri.companion]
+	return p
+}
+
+func TestCheckPlannedRoute(t *testing.T) {
+	for _, game := range []int{gameSeasons, gameAges} {
+		lines := make([][]string, 2)
+		logfs := make([]logFunc, len(lines))
+		for i := range logfs {
+			i := i
+			logfs[i] = func(s string, a ...interface{}) {
+				lines[i] = append(lines[i], fmt.Sprintf(s, a...))
+			}
+		}
+
+		// seed 4 is quick to find routes for
+		ropts := randomizerOptions{
+			dungeons: true,
+			portals:  game == gameSeasons,
+		}
+		src := rand.New(rand.NewSource(4))
+		route, err := findRoute(
+			newTestRomState(game), 4, src, ropts, false, logfs[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// a plan of the same route must be linked the same way, even though
+		// makePlannedRoute doesn't go through findRoute.
+		ri, err := makePlannedRoute(
+			newTestRomState(game), routePlan(route))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines[0] = lines[0][:0]
+		testExpect(t, checkPlannedRoute(route, game, logfs[0]), true)
+		testExpect(t, checkPlannedRoute(ri, game, logfs[1]), true)
+		testExpect(t, lines[1][0], "sphere 0:")
+		testExpect(t, lines[1][len(lines[1])-1], lines[0][len(lines[0])-1])
+	}
+}
@@ -0,0 +1,294 @@
+package randomizer
+
+import (
+	"container/list"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// implements the -plando flag: read a structured plando file (YAML or JSON)
+// and generate a seed that follows it. unlike -plan, anything the file doesn't
+// specify is randomized by the normal fill.
+
+// the maximum number of starting items, set by the size of the table in the
+// ROM.
+const maxStartingItems = 16
+
+// a plando file. names may be nice names or internal names, as in -plan.
+type plando struct {
+	Seed      string
+	Options   plandoOptions
+	Companion string
+	Items     map[string]string   // slot -> item
+	Require   map[string][]string // item -> hint areas it must be in
+	Forbid    map[string][]string // item -> hint areas it can't be in
+	Start     []string            // starting items
+	Hints     map[string]string   // owl -> hint text
+}
+
+// options that a plando file can set. these are the same as the command-line
+// flags of the same names, and are combined with them.
+type plandoOptions struct {
+	Hard     bool
+	Treewarp bool
+	Dungeons bool
+	Portals  bool
+	Decouple bool
+	D6Pair   bool `yaml:"d6pair"`
+	MixWarps bool `yaml:"mixwarps"`
+	Flute    string
+	Seasons  string
+}
+
+// a plando with names resolved for a game.
+type resolvedPlando struct {
+	items     map[string]string
+	require   map[string]map[string]bool // item -> set of lowercase areas
+	forbid    map[string]map[string]bool
+	start     []string
+	rings     []string
+	companion int               // set by a flute in items, if any
+	areas     map[string]string // slot -> lowercase hint area
+}
+
+// loads a plando file. JSON is a subset of YAML, so both are read the same way.
+func loadPlando(path string) (*plando, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := new(plando)
+	if err := yaml.UnmarshalStrict(b, p); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(p.Start) > maxStartingItems {
+		return nil, fmt.Errorf("too many starting items (max %d)",
+			maxStartingItems)
+	}
+	for owl, hint := range p.Hints {
+		if !isValidGameText(hint) {
+			return nil, fmt.Errorf("invalid hint text for %s: %q", owl, hint)
+		}
+	}
+	return p, nil
+}
+
+// sets options from a plando file. flags given on the command line are kept,
+// but the file's flute, seasons, and companion take precedence. the seed is
+// only used if one wasn't given.
+func (p *plando) applyOptions(ropts *randomizerOptions) error {
+	o := p.Options
+	ropts.hard = ropts.hard || o.Hard
+	ropts.treewarp = ropts.treewarp || o.Treewarp
+	ropts.dungeons = ropts.dungeons || o.Dungeons
+	ropts.portals = ropts.portals || o.Portals
+	ropts.decouple = ropts.decouple || o.Decouple
+	ropts.d6pair = ropts.d6pair || o.D6Pair
+	ropts.mixwarps = ropts.mixwarps || o.MixWarps
+
+	switch o.Flute {
+	case "", "anywhere":
+	case "progression-early":
+		ropts.earlyflute = true
+	default:
+		return fmt.Errorf("unknown flute placement: %s", o.Flute)
+	}
+	if o.Seasons != "" {
+		if getStringIndex(seasonModes, o.Seasons) == -1 {
+			return fmt.Errorf("unknown season mode: %s", o.Seasons)
+		}
+		ropts.seasons = o.Seasons
+	}
+	if p.Companion != "" {
+		companion := getStringIndex(companionNames, p.Companion)
+		if companion < ricky {
+			return fmt.Errorf("no such animal companion: %s", p.Companion)
+		}
+		ropts.companion = companion
+	}
+	if ropts.seed == "" {
+		ropts.seed = p.Seed
+	}
+	return nil
+}
+
+// resolves names in the plando for a ROM and checks that they exist.
+func (p *plando) resolve(rom *romState) (*resolvedPlando, error) {
+	rp := &resolvedPlando{
+		items:   make(map[string]string),
+		require: make(map[string]map[string]bool),
+		forbid:  make(map[string]map[string]bool),
+		areas:   make(map[string]string),
+	}
+
+	h := newHinter(rom.game)
+	validAreas := make(map[string]bool)
+	for slot, area := range h.areas {
+		rp.areas[slot] = strings.ToLower(area)
+		validAreas[strings.ToLower(area)] = true
+	}
+
+	checkItem := func(item string) error {
+		if _, ok := rom.treasures[item]; !ok &&
+			getStringIndex(rings, item) == -1 {
+			return fmt.Errorf("no such item: %s", item)
+		}
+		return nil
+	}
+
+	for slot, item := range p.Items {
+		slot = ungetNiceName(slot, rom.game)
+		item = ungetNiceName(item, rom.game)
+		if _, ok := rom.itemSlots[slot]; !ok {
+			return nil, fmt.Errorf("no such check: %s", slot)
+		}
+		if err := checkItem(item); err != nil {
+			return nil, err
+		}
+		rp.items[slot] = item
+		if strings.Contains(item, " ring") {
+			rp.rings = append(rp.rings, item)
+		}
+		if strings.HasSuffix(item, "'s flute") {
+			companion := getStringIndex(companionNames,
+				strings.TrimSuffix(item, "'s flute"))
+			if rp.companion != 0 && rp.companion != companion {
+				return nil, fmt.Errorf("can't have multiple types of flute")
+			}
+			rp.companion = companion
+		}
+	}
+
+	for _, c := range []struct {
+		src map[string][]string
+		dst map[string]map[string]bool
+	}{
+		{p.Require, rp.require},
+		{p.Forbid, rp.forbid},
+	} {
+		for item, areas := range c.src {
+			item = ungetNiceName(item, rom.game)
+			if err := checkItem(item); err != nil {
+				return nil, err
+			}
+			c.dst[item] = make(map[string]bool)
+			for _, area := range areas {
+				area = strings.ToLower(area)
+				if !validAreas[area] {
+					return nil, fmt.Errorf("no such area: %s", area)
+				}
+				c.dst[item][area] = true
+			}
+		}
+	}
+
+	for _, item := range p.Start {
+		item = ungetNiceName(item, rom.game)
+		if _, ok := rom.treasures[item]; !ok {
+			return nil, fmt.Errorf("no such item: %s", item)
+		}
+		rp.start = append(rp.start, item)
+	}
+
+	// fixed placements have to follow the constraints too
+	for slot, item := range rp.items {
+		if !rp.allows(item, slot) {
+			return nil, fmt.Errorf("%s in %s breaks an area constraint",
+				item, slot)
+		}
+	}
+
+	return rp, nil
+}
+
+// returns true iff the area constraints allow the item in the slot. a nil
+// plando allows anything.
+func (rp *resolvedPlando) allows(item, slot string) bool {
+	if rp == nil {
+		return true
+	}
+	area := rp.areas[slot]
+	if areas, ok := rp.require[item]; ok && !areas[area] {
+		return false
+	}
+	return !rp.forbid[item][area]
+}
+
+// gives the starting items to the player in logic. they're extra copies, not
+// taken from the item pool.
+func (rp *resolvedPlando) linkStartItems(g graph) error {
+	for _, item := range rp.start {
+		if g[item] == nil {
+			return fmt.Errorf("%s can't be a starting item", item)
+		}
+		g[item].addParent(g["start"])
+	}
+	return nil
+}
+
+// places fixed items from the pool in their slots, before the rest of the
+// fill. ring names are the randomized names.
+func (rp *resolvedPlando) placeItems(ri *routeInfo,
+	itemList, slotList *list.List) error {
+	for _, slotName := range orderedKeys(rp.items) {
+		itemName := rp.items[slotName]
+
+		var eItem, eSlot *list.Element
+		for ei := itemList.Front(); ei != nil; ei = ei.Next() {
+			if ei.Value.(*node).name == itemName {
+				eItem = ei
+				break
+			}
+		}
+		for es := slotList.Front(); es != nil; es = es.Next() {
+			if es.Value.(*node).name == slotName {
+				eSlot = es
+				break
+			}
+		}
+		if eItem == nil {
+			return fmt.Errorf("no %s left in item pool for %s",
+				itemName, slotName)
+		}
+		if eSlot == nil {
+			return fmt.Errorf("%s is already filled", slotName)
+		}
+
+		item, slot := eItem.Value.(*node), eSlot.Value.(*node)
+		if !itemFitsInSlot(item, slot) {
+			return fmt.Errorf("%s doesn't fit in %s", itemName, slotName)
+		}
+		item.removeParent(ri.graph["start"])
+		item.addParent(slot)
+		ri.usedItems.PushBack(itemList.Remove(eItem))
+		ri.usedSlots.PushBack(slotList.Remove(eSlot))
+	}
+	return nil
+}
+
+// writes the starting item table.
+func (rom *romState) setStartingItems(items []string) {
+	table := rom.codeMutables["startingItems"]
+	for i := range table.new {
+		table.new[i] = 0xff
+	}
+	for i, name := range items {
+		t := rom.treasures[name]
+		table.new[i*2] = t.id
+		table.new[i*2+1] = t.subid
+	}
+}
+
+// overwrites generated owl hints with ones from the plando.
+func (p *plando) applyHints(h *hinter, owlHints map[string]string) error {
+	for owl, hint := range p.Hints {
+		if _, ok := owlHints[owl]; !ok {
+			return fmt.Errorf("no such owl: %s", owl)
+		}
+		owlHints[owl] = h.format(hint)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package randomizer
+
+import (
+	"container/list"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadPlando(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plando")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	texts := map[string]string{
+		"p.yaml": "seed: 1234abcd\n" +
+			"options: {dungeons: true, flute: progression-early}\n" +
+			"companion: dimitri\n" +
+			"items: {maku tree: sword}\n" +
+			"require: {feather: [Spool Swamp]}\n" +
+			"start: [\"bombs, 10\"]\n" +
+			"hints: {dodongo owl: Hello.}\n",
+		"p.json": `{"seed": "1234abcd", "options": {"dungeons": true,
+			"flute": "progression-early"}, "companion": "dimitri",
+			"items": {"maku tree": "sword"},
+			"require": {"feather": ["Spool Swamp"]},
+			"start": ["bombs, 10"], "hints": {"dodongo owl": "Hello."}}`,
+		"bad.yaml": "itmes: {maku tree: sword}\n",
+	}
+	for name, text := range texts {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"p.yaml", "p.json"} {
+		p, err := loadPlando(filepath.Join(dir, name))
+		testExpect(t, err, nil)
+		if p == nil {
+			continue
+		}
+		testExpect(t, p.Items["maku tree"], "sword")
+		testExpect(t, p.Require["feather"], []string{"Spool Swamp"})
+		testExpect(t, p.Start, []string{"bombs, 10"})
+
+		ropts := &randomizerOptions{hard: true}
+		testExpect(t, p.applyOptions(ropts), nil)
+		testExpect(t, ropts.hard, true)
+		testExpect(t, ropts.dungeons, true)
+		testExpect(t, ropts.earlyflute, true)
+		testExpect(t, ropts.companion, dimitri)
+		testExpect(t, ropts.seed, "1234abcd")
+
+		ropts = &randomizerOptions{seed: "ffffffff"}
+		p.applyOptions(ropts)
+		testExpect(t, ropts.seed, "ffffffff")
+	}
+
+	_, err = loadPlando(filepath.Join(dir, "bad.yaml"))
+	testExpect(t, err != nil, true)
+}
+
+func TestPlandoConstraints(t *testing.T) {
+	rp := &resolvedPlando{
+		items: map[string]string{"cliff chest": "sword"},
+		require: map[string]map[string]bool{
+			"feather": {"cliff": true},
+		},
+		forbid: map[string]map[string]bool{
+			"flippers": {"field": true},
+		},
+		areas: map[string]string{
+			"field chest": "field",
+			"cliff chest": "cliff",
+		},
+	}
+	testExpect(t, rp.allows("feather", "cliff chest"), true)
+	testExpect(t, rp.allows("feather", "field chest"), false)
+	testExpect(t, rp.allows("flippers", "field chest"), false)
+	testExpect(t, rp.allows("flippers", "cliff chest"), true)
+	testExpect(t, rp.allows("sword", "field chest"), true)
+	testExpect(t, (*resolvedPlando)(nil).allows("feather", "field chest"),
+		true)
+
+	// fixed items are taken from the pool and placed
+	g := newGraph()
+	for _, name := range []string{"start", "field chest", "cliff chest"} {
+		g[name] = newNode(name, andNode)
+	}
+	for _, name := range []string{"sword", "feather"} {
+		g[name] = newNode(name, orNode)
+		g[name].addParent(g["start"])
+	}
+	ri := &routeInfo{graph: g, usedItems: list.New(), usedSlots: list.New()}
+	itemList, slotList := list.New(), list.New()
+	itemList.PushBack(g["feather"])
+	itemList.PushBack(g["sword"])
+	slotList.PushBack(g["field chest"])
+	slotList.PushBack(g["cliff chest"])
+
+	testExpect(t, rp.placeItems(ri, itemList, slotList), nil)
+	testExpect(t, itemList.Len(), 1)
+	testExpect(t, slotList.Len(), 1)
+	testExpect(t, g["sword"].parents, []*node{g["cliff chest"]})
+	testExpect(t, ri.usedSlots.Front().Value.(*node).name, "cliff chest")
+
+	// and can't be placed twice
+	testExpect(t, rp.placeItems(ri, itemList, slotList) != nil, true)
+}
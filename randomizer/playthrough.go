@@ -0,0 +1,136 @@
+package randomizer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// returns a minimal subset of checks that still allows the game to be
+// beaten. checks are removed one at a time, latest sphere first, and stay
+// removed if the goal is still reachable without them.
+func getPlaythrough(g graph, checks map[*node]*node, spheres [][]*node,
+	resetFunc func()) map[*node]*node {
+	// order checks by sphere, latest first, with unreachable checks before
+	// everything else. unreachable checks can always be removed, so their
+	// order doesn't matter.
+	order := make([]*node, 0, len(checks))
+	inSphere := make(map[*node]bool)
+	for _, sphere := range spheres {
+		for _, n := range sphere {
+			inSphere[n] = true
+		}
+	}
+	for slot := range checks {
+		if !inSphere[slot] {
+			order = append(order, slot)
+		}
+	}
+	for i := len(spheres) - 1; i >= 0; i-- {
+		for _, n := range spheres[i] {
+			if checks[n] != nil {
+				order = append(order, n)
+			}
+		}
+	}
+
+	removed := make(map[*node]*node)
+	for _, slot := range order {
+		item := checks[slot]
+		item.removeParent(slot)
+		resetFunc()
+		g.reset()
+		g["start"].explore()
+		if g["done"].reached {
+			removed[slot] = item
+		} else {
+			item.addParent(slot)
+		}
+	}
+
+	// put everything back
+	for slot, item := range removed {
+		item.addParent(slot)
+	}
+
+	required := make(map[*node]*node)
+	for slot, item := range checks {
+		if removed[slot] == nil {
+			required[slot] = item
+		}
+	}
+	return required
+}
+
+// returns spheres for only the given checks, as if no other items existed.
+func getPlaythroughSpheres(g graph, checks, required map[*node]*node,
+	resetFunc func()) [][]*node {
+	for slot, item := range checks {
+		if required[slot] == nil {
+			item.removeParent(slot)
+		}
+	}
+	spheres, _ := getSpheres(g, required, resetFunc)
+	for slot, item := range checks {
+		if required[slot] == nil {
+			item.addParent(slot)
+		}
+	}
+	return spheres
+}
+
+// returns the dungeons that contain required checks, in the order they're
+// first needed. if dungeon entrances are shuffled, entrances are included.
+func getPlaythroughDungeons(spheres [][]*node, required map[*node]*node,
+	entrances map[string]string) []string {
+	dungeons := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, sphere := range spheres {
+		for _, n := range sphere {
+			if required[n] == nil {
+				continue
+			}
+			dungeon := getDungeonName(n.name)
+			if dungeon == "" || seen[dungeon] {
+				continue
+			}
+			seen[dungeon] = true
+			if entrance, ok := reverseLookup(entrances, dungeon); ok &&
+				entrance.(string) != dungeon {
+				dungeon = fmt.Sprintf("%s (%s entrance)", dungeon, entrance)
+			}
+			dungeons = append(dungeons, dungeon)
+		}
+	}
+	return dungeons
+}
+
+// sends the playthrough section of a single-player log.
+func logPlaythrough(summary chan string, g graph, checks map[*node]*node,
+	spheres [][]*node, ri *routeInfo, game int, hardTricks []string,
+	resetFunc func()) {
+	required := getPlaythrough(g, checks, spheres, resetFunc)
+	requiredSpheres := getPlaythroughSpheres(g, checks, required, resetFunc)
+
+	sendSectionHeader(summary, "playthrough")
+	logSpheres(summary, required, requiredSpheres, nil, []int{game}, nil)
+
+	lines := make([]string, 0, 2)
+	if dungeons := getPlaythroughDungeons(
+		requiredSpheres, required, ri.entrances); len(dungeons) > 0 {
+		lines = append(lines, fmt.Sprintf("dungeons: %s",
+			strings.Join(dungeons, ", ")))
+	}
+	if len(hardTricks) > 0 {
+		lines = append(lines, fmt.Sprintf("hard tricks: %s",
+			strings.Join(hardTricks, ", ")))
+	}
+	if len(lines) > 0 {
+		summary <- ""
+		for _, line := range lines {
+			summary <- line
+		}
+	}
+
+	g.reset()
+	resetFunc()
+}
@@ -0,0 +1,64 @@
+package randomizer
+
+import (
+	"container/list"
+	"testing"
+)
+
+func TestPlaythrough(t *testing.T) {
+	// either feather or bombs opens d1, which has the flippers.
+	g := newGraph()
+	for _, name := range []string{"start", "chest a", "chest b",
+		"junk chest", "d1 chest", "done"} {
+		g[name] = newNode(name, andNode)
+	}
+	for _, name := range []string{"d1 entry", "feather", "bombs", "flippers",
+		"junk"} {
+		g[name] = newNode(name, orNode)
+	}
+	g.addParents(map[string][]string{
+		"chest a":    {"start"},
+		"chest b":    {"start"},
+		"junk chest": {"start"},
+		"d1 entry":   {"feather", "bombs"},
+		"d1 chest":   {"d1 entry"},
+		"done":       {"flippers"},
+	})
+	ri := &routeInfo{
+		graph:     g,
+		usedItems: list.New(),
+		usedSlots: list.New(),
+		entrances: map[string]string{"d1": "d2", "d2": "d1"},
+	}
+	for slot, item := range map[string]string{
+		"chest a":    "feather",
+		"chest b":    "bombs",
+		"junk chest": "junk",
+		"d1 chest":   "flippers",
+	} {
+		g[item].addParent(g[slot])
+		ri.usedItems.PushBack(g[item])
+		ri.usedSlots.PushBack(g[slot])
+	}
+
+	routes := []*routeInfo{ri}
+	mg, checks, spheres, _ := getAllSpheres(routes)
+	resetFunc := func() { ri.graph.reset() }
+	required := getPlaythrough(mg, checks, spheres, resetFunc)
+	testExpect(t, required, map[*node]*node{
+		g["chest b"]:  g["bombs"],
+		g["d1 chest"]: g["flippers"],
+	})
+
+	// other items are restored afterward
+	resetFunc()
+	mg.reset()
+	mg["start"].explore()
+	testExpect(t, g["feather"].reached, true)
+
+	requiredSpheres := getPlaythroughSpheres(mg, checks, required, resetFunc)
+	testExpect(t, len(requiredSpheres), 2)
+	testExpect(t, getPlaythroughDungeons(
+		requiredSpheres, required, ri.entrances),
+		[]string{"d1 (d2 entrance)"})
+}
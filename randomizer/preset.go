@@ -0,0 +1,288 @@
+package randomizer
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// implements the -preset flag: options from a YAML file, or from one of the
+// files embedded in presets/. presets set command-line flags that weren't
+// given, so that flags override presets.
+
+// a preset file. fields have the names of the flags they set, except for game,
+// name, and multi, which only apply per player in -multi, or to the game
+// chosen in the TUI.
+type preset struct {
+	Game       string
+	Seed       string
+	Hard       bool
+	Treewarp   bool
+	Dungeons   bool
+	D6Pair     bool `yaml:"d6pair"`
+	Portals    bool
+	MixWarps   bool `yaml:"mixwarps"`
+	Decouple   bool
+	Companion  string
+	Flute      string
+	Seasons    string
+	SetSeasons map[string]string `yaml:"setseasons"`
+	MaxSpheres int               `yaml:"maxspheres"`
+	MinDepth   int               `yaml:"mindepth"`
+	Icons      bool
+	Race       bool
+	RaceKey    string `yaml:"racekey"`
+	Hints      string
+	Include    []string
+	Plan       string
+	Plando     string
+	Name       string
+	Multi      []string // multiworld rules, like "local=sword"
+}
+
+// returns the names of the embedded presets.
+func presetNames() []string {
+	names := make([]string, 0)
+	dir, err := FS(false).Open("/presets/")
+	if err != nil {
+		return names
+	}
+	files, err := dir.Readdir(-1)
+	if err != nil {
+		return names
+	}
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ".yaml") {
+			names = append(names, strings.TrimSuffix(file.Name(), ".yaml"))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// built-in presets that go by a different name than requested, with why.
+var renamedPresets = map[string]struct{ name, reason string }{
+	"keysanity-race": {"entrances-race",
+		"there's no key shuffle; it shuffles every kind of entrance instead"},
+}
+
+// loads a preset from a file, or by name from the embedded presets.
+func loadPreset(s string) (*preset, error) {
+	b, err := ioutil.ReadFile(s)
+	if os.IsNotExist(err) {
+		if renamed, ok := renamedPresets[s]; ok {
+			return nil, fmt.Errorf("no such preset: %s (use %s; %s)",
+				s, renamed.name, renamed.reason)
+		}
+		if getStringIndex(presetNames(), s) == -1 {
+			return nil, fmt.Errorf("no such preset: %s (built-in presets: %s)",
+				s, strings.Join(presetNames(), ", "))
+		}
+		b, err = FSByte(false, "/presets/"+s+".yaml")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p := new(preset)
+	if err := yaml.UnmarshalStrict(b, p); err != nil {
+		return nil, fmt.Errorf("%s: %v", s, err)
+	}
+	switch p.Game {
+	case "", "seasons", "ages":
+	default:
+		return nil, fmt.Errorf("%s: unknown game: %s", s, p.Game)
+	}
+	return p, nil
+}
+
+// returns the values of the flags that the preset sets.
+func (p *preset) flagValues() map[string]string {
+	values := make(map[string]string)
+	for name, v := range map[string]bool{
+		"hard":     p.Hard,
+		"treewarp": p.Treewarp,
+		"dungeons": p.Dungeons,
+		"d6pair":   p.D6Pair,
+		"portals":  p.Portals,
+		"mixwarps": p.MixWarps,
+		"decouple": p.Decouple,
+		"icons":    p.Icons,
+		"race":     p.Race,
+	} {
+		if v {
+			values[name] = "true"
+		}
+	}
+	for name, v := range map[string]int{
+		"maxspheres": p.MaxSpheres,
+		"mindepth":   p.MinDepth,
+	} {
+		if v != 0 {
+			values[name] = strconv.Itoa(v)
+		}
+	}
+
+	overrides := make([]string, 0, len(p.SetSeasons))
+	for _, area := range orderedKeys(p.SetSeasons) {
+		overrides = append(overrides, area+":"+p.SetSeasons[area])
+	}
+	for name, v := range map[string]string{
+		"seed":       p.Seed,
+		"companion":  p.Companion,
+		"flute":      p.Flute,
+		"seasons":    p.Seasons,
+		"setseasons": strings.Join(overrides, ","),
+		"racekey":    p.RaceKey,
+		"hints":      p.Hints,
+		"include":    strings.Join(p.Include, ","),
+		"plan":       p.Plan,
+		"plando":     p.Plando,
+	} {
+		if v != "" {
+			values[name] = v
+		}
+	}
+	return values
+}
+
+// sets flags from the preset, except ones given on the command line.
+func (p *preset) setFlags() error {
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	for name, v := range p.flagValues() {
+		if !given[name] {
+			if err := flag.Set(name, v); err != nil {
+				return fmt.Errorf("preset: -%s: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// sets one multiworld player's options from the preset. options that apply to
+// the whole seed, like race mode and hint distribution, are ignored.
+func (p *preset) applyPlayer(ropts *randomizerOptions) error {
+	switch p.Game {
+	case "seasons":
+		ropts.game = gameSeasons
+	case "ages":
+		ropts.game = gameAges
+	}
+	ropts.hard = p.Hard
+	ropts.treewarp = p.Treewarp
+	ropts.dungeons = p.Dungeons
+	ropts.d6pair = p.D6Pair
+	ropts.portals = p.Portals
+	ropts.mixwarps = p.MixWarps
+	ropts.decouple = p.Decouple
+
+	if p.Companion != "" {
+		ropts.companion = getStringIndex(companionNames, p.Companion)
+		if ropts.companion == -1 {
+			return fmt.Errorf("unknown companion: %s", p.Companion)
+		}
+	}
+	switch p.Flute {
+	case "", "anywhere":
+	case "progression-early":
+		ropts.earlyflute = true
+	default:
+		return fmt.Errorf("unknown flute placement: %s", p.Flute)
+	}
+	if p.Seasons != "" {
+		if getStringIndex(seasonModes, p.Seasons) == -1 {
+			return fmt.Errorf("unknown season mode: %s", p.Seasons)
+		}
+		ropts.seasons = p.Seasons
+	}
+	for area, season := range p.SetSeasons {
+		if getStringIndex(seasonAreas, area) == -1 {
+			return fmt.Errorf("invalid season area: %s", area)
+		}
+		if getStringIndex(seasonsById, season) == -1 {
+			return fmt.Errorf("invalid default season: %s", season)
+		}
+		if ropts.seasonset == nil {
+			ropts.seasonset = make(map[string]string)
+		}
+		ropts.seasonset[area] = season
+	}
+
+	if p.Name != "" {
+		if err := checkPlayerName(p.Name); err != nil {
+			return err
+		}
+		ropts.name = p.Name
+	}
+	for _, rule := range p.Multi {
+		if err := parseMultiRule(rule, &ropts.multi); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parses a -multi player's preset, like "league" or "ages:beginner". returns
+// false if the string isn't a preset.
+func roptsFromPreset(s string, ropts *randomizerOptions) (bool, error) {
+	game, name := "", s
+	if a := strings.SplitN(s, ":", 2); len(a) == 2 {
+		switch a[0] {
+		case "s", "seasons":
+			game, name = "seasons", a[1]
+		case "a", "ages":
+			game, name = "ages", a[1]
+		}
+	}
+	if game == "" && (strings.Contains(s, "+") ||
+		getStringIndex([]string{"s", "seasons", "a", "ages"}, s) != -1) {
+		return false, nil
+	}
+
+	p, err := loadPreset(name)
+	if err != nil {
+		return true, err
+	}
+	if game != "" {
+		p.Game = game
+	}
+	if p.Game == "" {
+		return true, fmt.Errorf("no game for preset %s; use s:%s or a:%s",
+			name, name, name)
+	}
+	return true, p.applyPlayer(ropts)
+}
+
+// sets TUI settings from the preset named by the "preset" setting. other
+// settings are reset to their defaults, except the seed and output directory.
+func presetSettings(values map[string]string) error {
+	p, err := loadPreset(values["preset"])
+	if err != nil {
+		return err
+	}
+	for _, field := range settingFields {
+		switch field.name {
+		case "game", "preset", "seed", "outdir":
+		default:
+			values[field.name] = settingDefault(field.name)
+		}
+	}
+	for name, v := range p.flagValues() {
+		if _, ok := values[name]; ok {
+			values[name] = v
+		}
+	}
+	if p.Game != "" {
+		values["game"] = p.Game
+	}
+	return nil
+}
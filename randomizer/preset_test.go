@@ -0,0 +1,96 @@
+package randomizer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadPreset(t *testing.T) {
+	testExpect(t, presetNames(),
+		[]string{"beginner", "entrances-race", "league"})
+	for _, name := range presetNames() {
+		_, err := loadPreset(name)
+		testExpect(t, err, nil)
+	}
+	_, err := loadPreset("nonexistent")
+	testExpect(t, err != nil, true)
+	_, err = loadPreset("keysanity-race")
+	testExpect(t, err != nil && strings.Contains(err.Error(), "entrances-race"),
+		true)
+
+	dir, err := ioutil.TempDir("", "preset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "p.yaml")
+	if err := ioutil.WriteFile(path, []byte("game: ages\nhard: true\n"+
+		"maxspheres: 20\ncompanion: moosh\n"+
+		"setseasons: {spool swamp: winter, lost woods: autumn}\n"+
+		"include: [a.yaml, b.yaml]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := loadPreset(path)
+	testExpect(t, err, nil)
+	if p == nil {
+		return
+	}
+	testExpect(t, p.flagValues(), map[string]string{
+		"hard":       "true",
+		"maxspheres": "20",
+		"companion":  "moosh",
+		"setseasons": "lost woods:autumn,spool swamp:winter",
+		"include":    "a.yaml,b.yaml",
+	})
+
+	if err := ioutil.WriteFile(path, []byte("hrad: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = loadPreset(path)
+	testExpect(t, err != nil, true)
+}
+
+func TestMultiPreset(t *testing.T) {
+	ropts := &randomizerOptions{}
+	testExpect(t, roptsFromString("s:league/name=Alice", ropts), nil)
+	testExpect(t, ropts.game, gameSeasons)
+	testExpect(t, ropts.dungeons, true)
+	testExpect(t, ropts.earlyflute, true)
+	testExpect(t, ropts.name, "Alice")
+
+	ropts = &randomizerOptions{}
+	testExpect(t, roptsFromString("ages:beginner/local=sword", ropts), nil)
+	testExpect(t, ropts.game, gameAges)
+	testExpect(t, ropts.seasons, "vanilla")
+	testExpect(t, ropts.multi.local, []string{"sword"})
+
+	ropts = &randomizerOptions{}
+	testExpect(t, roptsFromString("a+hd", ropts), nil)
+	testExpect(t, ropts.game, gameAges)
+	testExpect(t, ropts.hard, true)
+
+	// built-in presets don't pick a game
+	testExpect(t, roptsFromString("league", ropts) != nil, true)
+}
+
+func TestSeasonOverrideString(t *testing.T) {
+	ropts := &randomizerOptions{seasons: "weighted", seasonset: map[string]string{
+		"north horon":    "winter",
+		"temple remains": "spring",
+	}}
+	s := optString(0x1234, ropts, "+")
+	testExpect(t, s, "00001234+wa3nnnnnnnn0")
+
+	parsed := &randomizerOptions{}
+	testExpect(t, roptsFromString("s"+s[8:]+"d", parsed), nil)
+	testExpect(t, parsed.seasons, "weighted")
+	testExpect(t, parsed.seasonset, ropts.seasonset)
+	testExpect(t, parsed.dungeons, true)
+
+	testExpect(t, roptsFromString("s+a3nn", parsed) != nil, true)
+	testExpect(t, roptsFromString("s+a3nnnnnnnn9", parsed) != nil, true)
+}
@@ -0,0 +1,222 @@
+package randomizer
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// race mode can write spoiler logs sealed with an organizer's key (-racekey),
+// so that logs can be handed out before a race and unlocked afterward with
+// -devcmd unseal. the key is random rather than a passphrase, since the ROM
+// SHA-1 is public and a passphrase could be guessed offline. "-racekey new"
+// generates and prints a key.
+//
+// a sealed log is a text file: a header line, the SHA-1 of the ROM, a
+// commitment (SHA-256 of the plaintext log), the GCM nonce, and the base64
+// ciphertext. the ROM SHA-1 and commitment are also authenticated as
+// additional data, so none of the header can be changed without unsealing
+// failing. publishing the commitment lets anyone verify that an unsealed log
+// is the one that was generated with the ROM.
+
+const sealedLogHeader = "oracles-randomizer sealed log"
+
+// the length of a race key in bytes. keys are given in hex.
+const raceKeySize = 32
+
+// returns a new random race key, in hex.
+func newRaceKey() (string, error) {
+	b := make([]byte, raceKeySize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// parses a race key from hex.
+func parseRaceKey(s string) ([]byte, error) {
+	key, err := hex.DecodeString(s)
+	if err != nil || len(key) != raceKeySize {
+		return nil, fmt.Errorf("race key must be %d hex digits; "+
+			"use -racekey new to generate one", 2*raceKeySize)
+	}
+	return key, nil
+}
+
+// checks the -racekey flag. keys only apply to race mode, except for
+// -devcmd unseal, which takes a key to open an existing log.
+func checkRaceKeyFlag(key string, race bool, devCmd string) error {
+	switch {
+	case key == "":
+		return nil
+	case devCmd == "unseal":
+		_, err := parseRaceKey(key)
+		return err
+	case !race:
+		return fmt.Errorf("-racekey only applies with -race")
+	case key == "new":
+		return nil
+	}
+	_, err := parseRaceKey(key)
+	return err
+}
+
+// replaces a race key of "new" with a random key, and prints it. all players
+// and seeds share the key.
+func setNewRaceKey(optsList []*randomizerOptions, logf logFunc) error {
+	if len(optsList) == 0 || !optsList[0].race ||
+		optsList[0].racekey != "new" {
+		return nil
+	}
+	key, err := newRaceKey()
+	if err != nil {
+		return err
+	}
+	for _, ropts := range optsList {
+		ropts.racekey = key
+	}
+	logf("race log key: %s", key)
+	return nil
+}
+
+// returns the AES-256 key for a ROM's log.
+func raceLogKey(key []byte, romSum string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("race log " + strings.ToLower(romSum)))
+	return mac.Sum(nil)
+}
+
+// returns the additional data authenticated with a sealed log.
+func sealedLogData(romSum, commitment string) []byte {
+	return []byte(strings.ToLower(romSum) + " " + commitment)
+}
+
+// encrypts a log and writes it to path, so that the plaintext is never
+// written to disk. returns the commitment hash.
+func sealLog(path string, plaintext, romSum []byte,
+	key string) (string, error) {
+	sumHex := fmt.Sprintf("%x", romSum)
+	commitment := fmt.Sprintf("%x", sha256.Sum256(plaintext))
+	gcm, err := newRaceLogCipher(key, sumHex)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	ciphertext := gcm.Seal(
+		nil, nonce, plaintext, sealedLogData(sumHex, commitment))
+
+	text := fmt.Sprintf("%s\nrom sha-1: %s\ncommitment: %s\nnonce: %x\n%s\n",
+		sealedLogHeader, sumHex, commitment, nonce,
+		base64.StdEncoding.EncodeToString(ciphertext))
+	if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+		return "", err
+	}
+
+	return commitment, nil
+}
+
+func newRaceLogCipher(key, romSum string) (cipher.AEAD, error) {
+	b, err := parseRaceKey(key)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(raceLogKey(b, romSum))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+var sumLineRegexp = regexp.MustCompile(`(?m)^sha-1 sum: ([0-9a-f]+)\r?$`)
+
+// decrypts a sealed log and verifies it against its commitment and the given
+// ROM. if romPath is empty, the log is only checked against the ROM SHA-1 in
+// its own header. returns the plaintext and the commitment.
+func unsealLog(sealedPath, romPath, key string) ([]byte, string, error) {
+	f, err := os.Open(sealedPath)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	// read header
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16*1024*1024)
+	lines := make([]string, 0, 5)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, "", err
+	}
+	if len(lines) != 5 || lines[0] != sealedLogHeader {
+		return nil, "", fmt.Errorf("%s is not a sealed log", sealedPath)
+	}
+	for _, line := range lines[1:4] {
+		a := strings.SplitN(line, ": ", 2)
+		if len(a) != 2 {
+			return nil, "", fmt.Errorf("bad sealed log line: %q", line)
+		}
+		fields[a[0]] = a[1]
+	}
+	romSum, commitment := fields["rom sha-1"], fields["commitment"]
+
+	// check the ROM first, since a mismatch there is the likelier mistake
+	if romPath != "" {
+		b, err := ioutil.ReadFile(romPath)
+		if err != nil {
+			return nil, "", err
+		}
+		if actual := fmt.Sprintf("%x", sha1.Sum(b)); actual != romSum {
+			return nil, "", fmt.Errorf("log is for ROM %s, not %s",
+				romSum, actual)
+		}
+	}
+
+	nonce, err := hex.DecodeString(fields["nonce"])
+	if err != nil {
+		return nil, "", fmt.Errorf("bad nonce: %v", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(lines[4])
+	if err != nil {
+		return nil, "", fmt.Errorf("bad ciphertext: %v", err)
+	}
+	gcm, err := newRaceLogCipher(key, romSum)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, "", fmt.Errorf("bad nonce length")
+	}
+	plaintext, err := gcm.Open(
+		nil, nonce, ciphertext, sealedLogData(romSum, commitment))
+	if err != nil {
+		return nil, "", fmt.Errorf("wrong key, or log has been modified")
+	}
+
+	// verify
+	if fmt.Sprintf("%x", sha256.Sum256(plaintext)) != commitment {
+		return nil, "", fmt.Errorf("log doesn't match commitment")
+	}
+	if m := sumLineRegexp.FindSubmatch(plaintext); m == nil ||
+		string(m[1]) != romSum {
+		return nil, "", fmt.Errorf("log doesn't match ROM SHA-1")
+	}
+
+	return plaintext, commitment, nil
+}
@@ -0,0 +1,112 @@
+package randomizer
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSealedLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "race")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := newRaceKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := newRaceKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// fake ROM and log
+	rom := []byte("not really a ROM")
+	romPath := filepath.Join(dir, "rom.gbc")
+	if err := ioutil.WriteFile(romPath, rom, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha1.Sum(rom)
+	log := fmt.Sprintf("seed: 00000000\r\nsha-1 sum: %x\r\n", sum)
+	sealedPath := filepath.Join(dir, "rom_log.txt.sealed")
+
+	// passphrases aren't keys
+	_, err = sealLog(sealedPath, []byte(log), sum[:], "hunter2")
+	testExpect(t, err != nil, true)
+	_, err = os.Stat(sealedPath)
+	testExpect(t, os.IsNotExist(err), true)
+
+	commitment, err := sealLog(sealedPath, []byte(log), sum[:], key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// good key, with and without ROM
+	for _, path := range []string{romPath, ""} {
+		plaintext, c, err := unsealLog(sealedPath, path, key)
+		testExpect(t, err, nil)
+		testExpect(t, string(plaintext), log)
+		testExpect(t, c, commitment)
+	}
+
+	// bad key
+	_, _, err = unsealLog(sealedPath, romPath, otherKey)
+	testExpect(t, err != nil, true)
+
+	// wrong ROM
+	otherPath := filepath.Join(dir, "other.gbc")
+	if err := ioutil.WriteFile(otherPath, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = unsealLog(sealedPath, otherPath, key)
+	testExpect(t, err != nil, true)
+
+	// changed commitment
+	b, err := ioutil.ReadFile(sealedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(string(b), "commitment: "+commitment,
+		"commitment: "+strings.Repeat("0", len(commitment)), 1)
+	if err := ioutil.WriteFile(
+		sealedPath, []byte(tampered), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = unsealLog(sealedPath, romPath, key)
+	testExpect(t, err != nil, true)
+}
+
+func TestNewRaceKey(t *testing.T) {
+	dummyLogf := func(string, ...interface{}) {}
+	optsList := []*randomizerOptions{
+		{race: true, racekey: "new"},
+		{race: true, racekey: "new"},
+	}
+	if err := setNewRaceKey(optsList, dummyLogf); err != nil {
+		t.Fatal(err)
+	}
+	_, err := parseRaceKey(optsList[0].racekey)
+	testExpect(t, err, nil)
+	testExpect(t, optsList[1].racekey, optsList[0].racekey)
+
+	// keys are only generated in race mode
+	ropts := &randomizerOptions{racekey: "new"}
+	setNewRaceKey([]*randomizerOptions{ropts}, dummyLogf)
+	testExpect(t, ropts.racekey, "new")
+
+	// and keys are rejected outside race mode, except to unseal logs
+	key := optsList[0].racekey
+	testExpect(t, checkRaceKeyFlag("", false, ""), nil)
+	testExpect(t, checkRaceKeyFlag("new", true, ""), nil)
+	testExpect(t, checkRaceKeyFlag(key, true, ""), nil)
+	testExpect(t, checkRaceKeyFlag(key, false, "") != nil, true)
+	testExpect(t, checkRaceKeyFlag("new", false, "") != nil, true)
+	testExpect(t, checkRaceKeyFlag(key, false, "unseal"), nil)
+	testExpect(t, checkRaceKeyFlag("abcd", true, "") != nil, true)
+}
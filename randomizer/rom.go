@@ -82,6 +82,7 @@ type romState struct {
 	bankEnds     []uint16 // bus offset of free space in each bank
 	assembler    *assembler
 	includes     []string // filenames
+	icons        []int    // indexes into hashIcons, if set
 }
 
 func newRomState(data []byte, game, player int, includes []string) *romState {
@@ -99,11 +100,11 @@ func newRomState(data []byte, game, player int, includes []string) *romState {
 
 // changes the contents of loaded ROM bytes in place. returns a checksum of the
 // result or an error.
-func (rom *romState) mutate(warpMap map[string]string, seed uint32,
+func (rom *romState) mutate(warpMap, exitMap map[string]string, seed uint32,
 	ropts *randomizerOptions) ([]byte, error) {
 	// need to set this *before* treasure map data
 	if len(warpMap) != 0 {
-		rom.setWarps(warpMap, ropts.dungeons)
+		rom.setWarps(warpMap, exitMap, ropts.dungeons)
 	}
 
 	if rom.game == gameSeasons {
@@ -198,6 +199,15 @@ func (rom *romState) mutate(warpMap map[string]string, seed uint32,
 	// do this last; includes have precendence over everything else
 	rom.addIncludes()
 
+	// except for the icons, which are derived from the rest of the ROM
+	if ropts.icons {
+		iconSum := sha1.Sum(rom.data)
+		rom.icons = getHashIcons(iconSum[:])
+		rom.setFileSelectIcons(rom.icons)
+		rom.codeMutables["dma_FileSelectStringTiles"].mutate(rom.data)
+		rom.codeMutables["dma_CustomFontLetters"].mutate(rom.data)
+	}
+
 	sum := makeRomChecksum(rom.data)
 	rom.data[0x14e] = sum[0]
 	rom.data[0x14f] = sum[1]
@@ -396,6 +406,10 @@ func (rom *romState) setCompassData() {
 		}
 
 		for _, slot := range slots {
+			// don't beep for other players' keys, from multiworld plans
+			if int(slot.player) != 0 && int(slot.player) != rom.player {
+				continue
+			}
 			offset := getDungeonPropertiesAddr(
 				rom.game, slot.group, slot.room).fullOffset()
 			rom.data[offset] = (rom.data[offset] & 0xbf) | 0x10 // set bit 4, reset bit 6
@@ -575,7 +589,28 @@ type warpData struct {
 	vanillaEntryData, vanillaExitData []byte // read from rom
 }
 
-func (rom *romState) setWarps(warpMap map[string]string, dungeons bool) {
+// mixing dungeons and portals shuffles both, so the mixwarps option implies
+// the dungeons and portals options.
+func normalizeWarpOptions(ropts *randomizerOptions) {
+	if ropts.mixwarps {
+		ropts.dungeons, ropts.portals = true, true
+	}
+}
+
+// returns an error if the options shuffle warps that the game doesn't have,
+// so that it can be checked before looking for a route.
+func checkWarpOptions(game int, ropts *randomizerOptions) error {
+	if game == gameAges && ropts.mixwarps {
+		return fmt.Errorf("ages doesn't have portals to mix with dungeons")
+	}
+	return nil
+}
+
+// sets warp data based on maps of entrance names to the destinations they
+// lead to, and of destination names to the entrances their exits lead out of.
+// in a coupled mapping, the exit map is the inverse of the warp map.
+func (rom *romState) setWarps(warpMap, exitMap map[string]string,
+	dungeons bool) {
 	// load yaml data
 	wd := make(map[string](map[string]*warpData))
 	if err := yaml.Unmarshal(
@@ -617,15 +652,25 @@ func (rom *romState) setWarps(warpMap map[string]string, dungeons bool) {
 		src, dest := warps[srcName], warps[destName]
 		for i := 0; i < src.len; i++ {
 			rom.data[src.entryOffset+i] = dest.vanillaEntryData[i]
-			rom.data[dest.exitOffset+i] = src.vanillaExitData[i]
 		}
 		dest.MapTile = src.vanillaMapTile
+	}
+	for destName, srcName := range exitMap {
+		src, dest := warps[srcName], warps[destName]
+		for i := 0; i < dest.len; i++ {
+			rom.data[dest.exitOffset+i] = src.vanillaExitData[i]
+		}
 
+		// essence warps name a room and position, which portals have no
+		// data for, so dungeons reached through portals keep their vanilla
+		// essence warps.
 		destEssence := warps[destName+" essence"]
-		if destEssence != nil && destEssence.exitOffset != 0 {
-			srcEssence := warps[srcName+" essence"]
+		srcEssence := warps[srcName+" essence"]
+		if destEssence != nil && destEssence.exitOffset != 0 &&
+			srcEssence != nil {
 			for i := 0; i < destEssence.len; i++ {
-				rom.data[destEssence.exitOffset+i] = srcEssence.vanillaExitData[i]
+				rom.data[destEssence.exitOffset+i] =
+					srcEssence.vanillaExitData[i]
 			}
 		}
 	}
@@ -698,6 +743,9 @@ func (rom *romState) setFileSelectText(row2 string) {
 	fileSelectRow1 := stringToTiles(strings.ToUpper(ternary(len(version) == 5,
 		fmt.Sprintf("randomizer %s", version),
 		fmt.Sprintf("rando %10s", version)[:16]).(string)))
+	if len(row2) > 16 {
+		row2 = row2[:16] // many flags won't fit
+	}
 	fileSelectRow2 := stringToTiles(
 		strings.ToUpper(strings.ReplaceAll(row2, "-", " ")))
 
@@ -712,6 +760,94 @@ func (rom *romState) setFileSelectText(row2 string) {
 	tiles.new = buf.Bytes()
 }
 
+// 8x8 icons that can replace the second row of the file select string, one
+// byte per row. they're drawn in the custom font's two colors, since the
+// string is one tile high and has a fixed palette. these are drawn by hand
+// rather than taken from treasure sprites, which are 16x16 objects with their
+// own palettes; see the -icons section of the readme.
+var hashIcons = []struct {
+	name string
+	tile [8]byte
+}{
+	{"sword", [8]byte{0x01, 0x03, 0x06, 0x4c, 0x38, 0x30, 0x48, 0x80}},
+	{"shield", [8]byte{0x7e, 0xff, 0xff, 0xff, 0xff, 0x7e, 0x3c, 0x18}},
+	{"boomerang", [8]byte{0x7c, 0xfe, 0xc0, 0xc0, 0xc0, 0xc0, 0xc0, 0x80}},
+	{"bombs", [8]byte{0x06, 0x08, 0x3c, 0x7e, 0x7e, 0x7e, 0x7e, 0x3c}},
+	{"feather", [8]byte{0x03, 0x0f, 0x1e, 0x3c, 0x78, 0x60, 0x80, 0x00}},
+	{"bracelet", [8]byte{0x00, 0x7e, 0xc3, 0xc3, 0xc3, 0x7e, 0x00, 0x00}},
+	{"ring", [8]byte{0x18, 0x3c, 0x18, 0x3c, 0x42, 0x42, 0x42, 0x3c}},
+	{"flute", [8]byte{0x03, 0x07, 0x0a, 0x1c, 0x28, 0x70, 0xe0, 0xc0}},
+	{"shovel", [8]byte{0x18, 0x18, 0x18, 0x18, 0x7e, 0x7e, 0x7e, 0x3c}},
+	{"heart", [8]byte{0x66, 0xff, 0xff, 0xff, 0x7e, 0x3c, 0x18, 0x00}},
+	{"rupee", [8]byte{0x18, 0x3c, 0x7e, 0x66, 0x66, 0x7e, 0x3c, 0x18}},
+	{"key", [8]byte{0x38, 0x44, 0x44, 0x38, 0x10, 0x1c, 0x10, 0x18}},
+	{"potion", [8]byte{0x3c, 0x18, 0x18, 0x3c, 0x7e, 0x7e, 0x7e, 0x3c}},
+	{"magnet", [8]byte{0xc3, 0xc3, 0xc3, 0xc3, 0xc3, 0xe7, 0x7e, 0x3c}},
+	{"slingshot", [8]byte{0xc3, 0xc3, 0x66, 0x3c, 0x18, 0x18, 0x18, 0x18}},
+	{"map", [8]byte{0xff, 0x81, 0xbd, 0x81, 0xb9, 0x81, 0xff, 0x00}},
+}
+
+const numHashIcons = 5
+
+// returns indexes into hashIcons for the SHA-1 of a ROM's data before the
+// icons are drawn, so that ROMs with any difference get different icons.
+func getHashIcons(sum []byte) []int {
+	icons := make([]int, numHashIcons)
+	for i := range icons {
+		icons[i] = int(sum[i]) % len(hashIcons)
+	}
+	return icons
+}
+
+// returns the names of hash icons, for the log.
+func getHashIconNames(icons []int) []string {
+	names := make([]string, len(icons))
+	for i, icon := range icons {
+		names[i] = hashIcons[icon].name
+	}
+	return names
+}
+
+// replace the second row of the file select string with icons. the icons are
+// drawn over custom font letters that aren't used in the first row.
+func (rom *romState) setFileSelectIcons(icons []int) {
+	tiles := rom.codeMutables["dma_FileSelectStringTiles"]
+	letters := rom.codeMutables["dma_CustomFontLetters"]
+	firstLetter := stringToTiles("A")[0]
+
+	used := make(map[byte]bool)
+	for _, tile := range tiles.new[2:0x12] {
+		used[tile] = true
+	}
+	iconTiles := make(map[int]byte)
+	next := firstLetter + 25 // start from Z, since it's least likely used
+	for _, icon := range icons {
+		if _, ok := iconTiles[icon]; ok {
+			continue
+		}
+		for used[next] {
+			next--
+		}
+		iconTiles[icon] = next
+		used[next] = true
+		i := int(next-firstLetter) * 16
+		for j, row := range hashIcons[icon].tile {
+			letters.new[i+j*2] = row
+			letters.new[i+j*2+1] = 0xff
+		}
+	}
+
+	// space icons out, centered
+	row2 := tiles.new[0x22:0x32]
+	for i := range row2 {
+		row2[i] = stringToTiles(" ")[0]
+	}
+	start := (len(row2) - (len(icons)*2 - 1)) / 2
+	for i, icon := range icons {
+		row2[start+i*2] = iconTiles[icon]
+	}
+}
+
 // returns a conversion of the string to file select screen tile indexes, using
 // the custom font.
 func stringToTiles(s string) []byte {
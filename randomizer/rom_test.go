@@ -1,6 +1,8 @@
 package randomizer
 
 import (
+	"bytes"
+	"crypto/sha1"
 	"testing"
 )
 
@@ -27,3 +29,59 @@ func TestMutableOverlap(t *testing.T) {
 func TestProcessText(t *testing.T) {
 	testExpect(t, processText("A\\xff # hello\nB"), []byte{'A', 0xff, 'B'})
 }
+
+func TestFileSelectIcons(t *testing.T) {
+	rom := &romState{codeMutables: map[string]*mutableRange{
+		"dma_FileSelectStringTiles": {new: make([]byte, 0x40)},
+		"dma_CustomFontLetters":     {new: make([]byte, 26*16)},
+	}}
+	rom.setFileSelectText("race-123")
+	rom.setFileSelectIcons([]int{0, 1, 0, 2, 3})
+
+	tiles := rom.codeMutables["dma_FileSelectStringTiles"].new
+	letters := rom.codeMutables["dma_CustomFontLetters"].new
+	row1, row2 := tiles[2:0x12], tiles[0x22:0x32]
+	space := stringToTiles(" ")[0]
+
+	// icons are spaced out and don't reuse letters from the first row
+	testExpect(t, row2[:5], []byte{space, space, space, row2[3], space})
+	testExpect(t, row2[3], row2[7])
+	testExpect(t, row2[3] != row2[5], true)
+	for i, icon := range []int{0, 1, 0, 2, 3} {
+		tile := row2[3+i*2]
+		testExpect(t, bytes.IndexByte(row1, tile), -1)
+		offset := int(tile-stringToTiles("A")[0]) * 16
+		testExpect(t, letters[offset], hashIcons[icon].tile[0])
+		testExpect(t, letters[offset+1], byte(0xff))
+	}
+
+	// icons come from the ROM's SHA-1
+	sum := sha1.Sum([]byte("not really a ROM"))
+	icons := getHashIcons(sum[:])
+	testExpect(t, len(icons), numHashIcons)
+	for i, icon := range icons {
+		testExpect(t, icon, int(sum[i])%len(hashIcons))
+	}
+	testExpect(t, len(getHashIconNames(icons)), numHashIcons)
+}
+
+func TestCheckWarpOptions(t *testing.T) {
+	ropts := &randomizerOptions{mixwarps: true}
+	normalizeWarpOptions(ropts)
+	testExpect(t, ropts.dungeons && ropts.portals, true)
+	testExpect(t, checkWarpOptions(gameSeasons, ropts), nil)
+	testExpect(t, checkWarpOptions(gameAges, ropts) != nil, true)
+}
+
+func TestMixedEssenceWarp(t *testing.T) {
+	rom := newTestRomState(gameSeasons)
+	rom.data = make([]byte, 0x100000)
+	portalExit := (&address{0x04, 0x76b5}).fullOffset() // eastern suburbs
+	copy(rom.data[portalExit:], []byte{0x1a, 0x50})
+	essence := (&address{0x09, 0x4b59}).fullOffset() // d1
+	copy(rom.data[essence:], []byte{0x80, 0x96, 0x44, 0x01})
+
+	rom.setWarps(map[string]string{"eastern suburbs portal": "d1"},
+		map[string]string{"d1": "eastern suburbs portal"}, false)
+	testExpect(t, rom.data[essence:essence+4], []byte{0x80, 0x96, 0x44, 0x01})
+}
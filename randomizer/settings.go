@@ -0,0 +1,332 @@
+package randomizer
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell"
+	"gopkg.in/yaml.v2"
+)
+
+// the TUI settings form sets command-line flags by name, so that options from
+// the form go through the same code as options from the command line. the
+// last-used settings are saved in a file next to the executable.
+
+const settingsFilename = "oracles-randomizer-settings.yaml"
+
+// kinds of settings form fields.
+const (
+	fieldCheck  = iota // bool flag
+	fieldChoice        // one of a list of strings
+	fieldText          // free text
+	fieldFile          // free text, or a file in the executable's directory
+)
+
+// a field in the settings form. name is the name of a flag, except for
+// "game", which picks the ROM when both are found.
+type settingField struct {
+	name    string
+	label   string
+	kind    int
+	choices []string // for fieldChoice; file extensions for fieldFile
+}
+
+var settingFields = []settingField{
+	{"game", "game", fieldChoice, []string{"any", "seasons", "ages"}},
+	{"preset", "preset", fieldFile, []string{".yaml"}},
+	{"seed", "seed", fieldText, nil},
+	{"hard", "hard difficulty", fieldCheck, nil},
+	{"treewarp", "tree warp", fieldCheck, nil},
+	{"dungeons", "shuffle dungeons", fieldCheck, nil},
+	{"d6pair", "keep d6 entrances together (ages)", fieldCheck, nil},
+	{"portals", "shuffle portals (seasons)", fieldCheck, nil},
+	{"mixwarps", "mix dungeons and portals (seasons)", fieldCheck, nil},
+	{"decouple", "decouple portal exits (seasons)", fieldCheck, nil},
+	{"companion", "animal companion", fieldChoice, companionNames},
+	{"flute", "flute placement", fieldChoice,
+		[]string{"anywhere", "progression-early"}},
+	{"seasons", "default seasons (seasons)", fieldChoice, seasonModes},
+	{"setseasons", "season overrides (seasons)", fieldText, nil},
+	{"maxspheres", "max spheres", fieldText, nil},
+	{"mindepth", "min depth", fieldText, nil},
+	{"icons", "hash icons on file select", fieldCheck, nil},
+	{"race", "race mode", fieldCheck, nil},
+	{"racekey", "race log key", fieldText, nil},
+	{"hints", "hint distribution", fieldFile, []string{".yaml"}},
+	{"include", "asm includes", fieldFile, []string{".yaml"}},
+	{"plan", "plan (spoiler log)", fieldFile, []string{".txt"}},
+	{"plando", "plando file", fieldFile, []string{".yaml", ".json"}},
+	{"multi", "multiworld players", fieldText, nil},
+	{"multifill", "multiworld fill", fieldChoice, multiFillModes},
+	{"outdir", "output directory", fieldText, nil},
+}
+
+// settings that are never written to or read from the settings file, since
+// the file is plain text next to the executable.
+var secretSettings = map[string]bool{
+	"racekey": true,
+}
+
+// returns the default value of a settings field.
+func settingDefault(name string) string {
+	if name == "game" {
+		return "any"
+	}
+	return flag.Lookup(name).DefValue
+}
+
+// returns the path of the settings file, or "" if the executable can't be
+// found.
+func settingsPath() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(exe), settingsFilename)
+}
+
+// returns settings from the file at path, then from flags given on the command
+// line. unknown or missing values are defaults.
+func loadSettings(path string) map[string]string {
+	values := make(map[string]string)
+	for _, field := range settingFields {
+		values[field.name] = settingDefault(field.name)
+	}
+
+	saved := make(map[string]string)
+	if b, err := ioutil.ReadFile(path); err == nil {
+		yaml.Unmarshal(b, saved) // a bad file is the same as no file
+	}
+	for k, v := range saved {
+		if _, ok := values[k]; ok && !secretSettings[k] {
+			values[k] = v
+		}
+	}
+
+	// a preset on the command line replaces saved settings
+	given := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		if _, ok := values[f.Name]; ok {
+			given[f.Name] = f.Value.String()
+		}
+	})
+	if preset, ok := given["preset"]; ok {
+		values["preset"] = preset
+		presetSettings(values)
+	}
+	for k, v := range given {
+		values[k] = v
+	}
+	return values
+}
+
+// writes settings that differ from the defaults to a file, except secrets.
+func saveSettings(path string, values map[string]string) error {
+	changed := make(map[string]string)
+	for k, v := range values {
+		if v != settingDefault(k) && !secretSettings[k] {
+			changed[k] = v
+		}
+	}
+	b, err := yaml.Marshal(changed)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// sets flags from settings.
+func applySettings(values map[string]string) error {
+	for _, field := range settingFields {
+		if field.name == "game" {
+			continue
+		}
+		if err := flag.Set(field.name, values[field.name]); err != nil {
+			return fmt.Errorf("%s: %v", field.label, err)
+		}
+	}
+	return nil
+}
+
+// returns options from settings, as from the equivalent command line.
+func settingsOptions(values map[string]string) ([]*randomizerOptions, error) {
+	if err := applySettings(values); err != nil {
+		return nil, err
+	}
+	optsList, err := getOptions()
+	if err != nil {
+		return nil, err
+	}
+	if game := values["game"]; game != "any" && flagMulti == "" {
+		optsList[0].game = reverseLookupOrPanic(gameNames, game).(int)
+	}
+	return optsList, nil
+}
+
+// returns the command-line flags equivalent to settings, excluding ones with
+// default values.
+func settingsString(values map[string]string) string {
+	a := make([]string, 0)
+	for _, field := range settingFields {
+		v := values[field.name]
+		switch {
+		case field.name == "game" || v == settingDefault(field.name):
+		case field.kind == fieldCheck:
+			a = append(a, "-"+field.name)
+		case v == "" || strings.ContainsAny(v, " ,:"):
+			a = append(a, fmt.Sprintf("-%s %q", field.name, v))
+		default:
+			a = append(a, fmt.Sprintf("-%s %s", field.name, v))
+		}
+	}
+	return strings.Join(a, " ")
+}
+
+// returns the paths of files in dir with any of the given extensions, sorted.
+func listFiles(dir string, exts []string) []string {
+	files := make([]string, 0)
+	fi, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return files
+	}
+	for _, info := range fi {
+		for _, ext := range exts {
+			if !info.IsDir() &&
+				strings.HasSuffix(strings.ToLower(info.Name()), ext) {
+				files = append(files, filepath.Join(dir, info.Name()))
+				break
+			}
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// returns the next (or previous, if step is -1) value in a, after v. if v isn't
+// in a, the first value is returned.
+func cycleValue(a []string, v string, step int) string {
+	if len(a) == 0 {
+		return v
+	}
+	i := getStringIndex(a, v)
+	if i == -1 {
+		return a[0]
+	}
+	return a[(i+step+len(a))%len(a)]
+}
+
+// shows the settings form and blocks until the user starts generation or
+// quits. values are modified in place. returns false if the user quit.
+func (ui *uiInstance) settingsForm(values map[string]string,
+	dir string) bool {
+	cursor, editing := 0, false
+	ui.change <- modeForm
+	for {
+		ui.setForm <- uiForm{settingsLines(values, cursor, editing), cursor}
+
+		ch := <-ui.prompt
+		field := settingFields[cursor]
+		if editing {
+			v := values[field.name]
+			switch ch {
+			case rune(tcell.KeyEnter), rune(tcell.KeyEscape):
+				editing = false
+				if field.name == "preset" && v != "" {
+					presetSettings(values)
+				}
+			case rune(tcell.KeyDEL), rune(tcell.KeyBackspace):
+				if len(v) > 0 {
+					values[field.name] = v[:len(v)-1]
+				}
+			default:
+				if ch >= ' ' && ch <= '~' {
+					values[field.name] = v + string(ch)
+				}
+			}
+			continue
+		}
+
+		switch ch {
+		case rune(tcell.KeyUp), 'k':
+			cursor = (cursor - 1 + len(settingFields)) % len(settingFields)
+		case rune(tcell.KeyDown), rune(tcell.KeyTab), 'j':
+			cursor = (cursor + 1) % len(settingFields)
+		case rune(tcell.KeyLeft), rune(tcell.KeyRight), ' ',
+			rune(tcell.KeyEnter):
+			step := ternary(ch == rune(tcell.KeyLeft), -1, 1).(int)
+			switch field.kind {
+			case fieldCheck:
+				values[field.name] = fmt.Sprint(values[field.name] != "true")
+			case fieldChoice:
+				values[field.name] = cycleValue(
+					field.choices, values[field.name], step)
+			case fieldText:
+				editing = ch == rune(tcell.KeyEnter) || ch == ' '
+			case fieldFile:
+				if ch == rune(tcell.KeyEnter) {
+					editing = true
+				} else {
+					files := []string{""}
+					if field.name == "preset" {
+						files = append(files, presetNames()...)
+					}
+					files = append(files, listFiles(dir, field.choices)...)
+					values[field.name] = cycleValue(
+						files, values[field.name], step)
+					if field.name == "preset" && values[field.name] != "" {
+						presetSettings(values)
+					}
+				}
+			}
+		case 'g':
+			ui.change <- modeWorking
+			return true
+		case 'q', rune(tcell.KeyEscape):
+			ui.quit <- true
+			return false
+		}
+	}
+}
+
+// returns the lines of the settings form.
+func settingsLines(values map[string]string, cursor int,
+	editing bool) []uiLine {
+	bold := tcell.StyleDefault.Bold(true)
+	lines := make([]uiLine, 0, len(settingFields)+4)
+	for i, field := range settingFields {
+		marker := ternary(i == cursor, "> ", "  ").(string)
+		v := values[field.name]
+		var line uiLine
+		switch field.kind {
+		case fieldCheck:
+			box := ternary(v == "true", "[x] ", "[ ] ").(string)
+			line = uiLine{{text: marker + box + field.label}}
+		case fieldChoice:
+			line = uiLine{{text: marker + field.label + ": "},
+				{text: "< " + v + " >"}}
+		default:
+			if editing && i == cursor {
+				v += "_"
+			}
+			line = uiLine{{text: marker + field.label + ": "},
+				{text: v, el: ellipsisLeft}}
+		}
+		if i == cursor {
+			for j := range line {
+				line[j].style = bold
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	lines = append(lines, uiLine{}, uiLine{
+		{text: "options: "},
+		{text: settingsString(values), el: ellipsisLeft},
+	})
+	return lines
+}
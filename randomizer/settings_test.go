@@ -0,0 +1,50 @@
+package randomizer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSettings(t *testing.T) {
+	initFlags()
+	values := loadSettings("")
+	testExpect(t, values["game"], "any")
+	testExpect(t, values["companion"], "random")
+	testExpect(t, settingsString(values), "")
+
+	values["hard"] = "true"
+	values["seed"] = "1234abcd"
+	values["setseasons"] = "lost woods:winter"
+	testExpect(t, settingsString(values),
+		`-seed 1234abcd -hard -setseasons "lost woods:winter"`)
+
+	testExpect(t, cycleValue([]string{"a", "b", "c"}, "c", 1), "a")
+	testExpect(t, cycleValue([]string{"a", "b", "c"}, "a", -1), "c")
+	testExpect(t, cycleValue([]string{"a", "b", "c"}, "x", 1), "a")
+
+	dir, err := ioutil.TempDir("", "settings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, settingsFilename)
+	testExpect(t, saveSettings(path, values), nil)
+	testExpect(t, loadSettings(path), values)
+
+	// race keys aren't saved, or loaded from an old file
+	values["racekey"] = "00112233445566778899aabbccddeeff"
+	testExpect(t, saveSettings(path, values), nil)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testExpect(t, strings.Contains(string(b), "racekey"), false)
+	if err := ioutil.WriteFile(path, []byte("racekey: abcd\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	testExpect(t, loadSettings(path)["racekey"], "")
+}
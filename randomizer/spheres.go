@@ -93,9 +93,11 @@ func getSpheres(g graph, checks map[*node]*node, resetFunc func()) ([][]*node, [
 	return spheres, extra
 }
 
-// logSpheres prints item placement by sphere to the summary channel.
+// logSpheres prints item placement by sphere to the summary channel. games is
+// indexed by player number minus one, or has one element for single-player.
 func logSpheres(summary chan string, checks map[*node]*node,
-	spheres [][]*node, extra []*node, game int, filter func(string) bool) {
+	spheres [][]*node, extra []*node, games []int,
+	filter func(string) bool) {
 	// don't print an extra newline before the first sphere in the section.
 	firstSphere := true
 
@@ -109,17 +111,7 @@ func logSpheres(summary chan string, checks map[*node]*node,
 			}
 			for _, n := range sphere {
 				if n == slot {
-					if slot.player == 0 {
-						lines = append(lines, fmt.Sprintf("%-28s <- %s",
-							getNiceName(slot.name, game),
-							getNiceName(item.name, game)))
-					} else {
-						lines = append(lines, fmt.Sprintf("P%d %-28s <- P%d %s",
-							slot.player,
-							getNiceName(slot.name, game),
-							checks[slot].player,
-							getNiceName(item.name, game)))
-					}
+					lines = append(lines, formatCheck(slot, item, games))
 					break
 				}
 			}
@@ -147,6 +139,18 @@ func logSpheres(summary chan string, checks map[*node]*node,
 	}
 }
 
+// returns a log line for a check, like "slot <- item" or, in multiworld,
+// "P1 slot <- P2 item".
+func formatCheck(slot, item *node, games []int) string {
+	if slot.player == 0 {
+		return fmt.Sprintf("%-28s <- %s", getNiceName(slot.name, games[0]),
+			getNiceName(item.name, games[0]))
+	}
+	return fmt.Sprintf("P%d %-28s <- P%d %s",
+		slot.player, getNiceName(slot.name, games[slot.player-1]),
+		item.player, getNiceName(item.name, games[item.player-1]))
+}
+
 // collates all the checks from multiple routes and returns check/sphere data.
 // also returns a "master graph" which contains all the route graphs.
 func getAllSpheres(routes []*routeInfo) (graph, map[*node]*node, [][]*node, []*node) {
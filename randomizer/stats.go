@@ -1,80 +1,342 @@
 package randomizer
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
 	"math/rand"
 	"os"
 	"runtime"
-
-	"gopkg.in/yaml.v2"
+	"sort"
+	"strings"
 )
 
-// generate a bunch of seeds.
-func generateSeeds(n, game int, ropts randomizerOptions) []*routeInfo {
-	threads := runtime.NumCPU()
+// a seed generated for stats, with the fill attempts it took.
+type statsRoute struct {
+	i        int
+	route    *routeInfo
+	attempts int
+	failures int
+	err      error
+}
+
+// generate n seeds from a master seed. like batch mode, the results depend
+// only on the master seed and options, regardless of how work is split among
+// threads. also returns the total number of fill attempts and the number of
+// route searches that failed. returns an error if a seed still has no route
+// after maxSeedRerolls rerolls.
+func generateSeeds(n, game int, master uint32,
+	ropts randomizerOptions) ([]*routeInfo, int, int, error) {
 	dummyLogf := func(string, ...interface{}) {}
+	seeds := getBatchSeeds(master, n)
 
-	// search for routes
-	routeChan := make(chan *routeInfo)
-	attempts := 0
-	for i := 0; i < threads; i++ {
+	// search for routes, rerolling failed seeds deterministically
+	jobs := make(chan int)
+	results := make(chan statsRoute)
+	for i := 0; i < runtime.NumCPU(); i++ {
 		go func() {
-			for i := 0; i < n/threads; i++ {
-				for {
-					// i don't know if a new romState actually *needs* to be
-					// created for each iteration.
-					seed := uint32(rand.Int())
+			for i := range jobs {
+				result := statsRoute{i: i}
+				seed := seeds[i]
+				reroll := rand.New(rand.NewSource(int64(seed)))
+				for result.route == nil {
 					src := rand.New(rand.NewSource(int64(seed)))
 					rom := newRomState(nil, game, 1, ropts.include)
-					route, _ := findRoute(rom, seed, src, ropts, false, dummyLogf)
-					if route != nil {
-						attempts += route.attemptCount
-						routeChan <- route
-						break
+					var err error
+					result.route, err = findRoute(
+						rom, seed, src, ropts, false, dummyLogf)
+					if result.route == nil {
+						if result.failures == maxSeedRerolls {
+							result.err = fmt.Errorf(
+								"seed %d: %v (after %d rerolls)",
+								i+1, err, result.failures)
+							break
+						}
+						result.attempts += maxTries
+						result.failures++
+						seed = reroll.Uint32()
 					}
 				}
+				if result.route != nil {
+					result.attempts += result.route.attemptCount
+				}
+				results <- result
 			}
 		}()
 	}
+	go func() {
+		for i := range seeds {
+			jobs <- i
+		}
+		close(jobs)
+	}()
 
-	// receive found routes
-	routes := make([]*routeInfo, n/threads*threads)
-	for i := 0; i < len(routes); i++ {
-		routes[i] = <-routeChan
+	// receive found routes. keep receiving after an error, so that the
+	// workers can finish.
+	routes := make([]*routeInfo, n)
+	attempts, failures := 0, 0
+	var err error
+	for i := range routes {
+		result := <-results
+		if result.err != nil {
+			if err == nil {
+				err = result.err
+			}
+			continue
+		}
+		routes[result.i] = result.route
+		attempts += result.attempts
+		failures += result.failures
 		fmt.Fprintf(os.Stderr, "%d routes found\n", i+1)
 	}
-	fmt.Fprintf(os.Stderr, "%.01f%% of seeds succeeded\n",
-		100*float64(n)/float64(attempts))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if n > 0 {
+		fmt.Fprintf(os.Stderr, "%.01f%% of attempts succeeded\n",
+			100*float64(n)/float64(attempts))
+	}
+
+	return routes, attempts, failures, nil
+}
+
+// aggregated results of many seeds. sphere numbers start at zero, as in logs.
+type seedStats struct {
+	Version    string `json:"version"`
+	Game       string `json:"game"`
+	Options    string `json:"options"` // see statsOptionString
+	MasterSeed string `json:"masterSeed"`
+	Seeds      int    `json:"seeds"`
+
+	// fill attempts, and route searches that used up all their attempts
+	Attempts       int     `json:"attempts"`
+	FailedSearches int     `json:"failedSearches"`
+	FailureRate    float64 `json:"failureRate"`
+
+	SlotItems   map[string]map[string]int `json:"slotItems"`   // slot -> item
+	ItemSpheres map[string]map[int]int    `json:"itemSpheres"` // item -> sphere
+	Reachable   map[string]int            `json:"reachable"`   // slot
+	Entrances   map[string]map[string]int `json:"entrances"`   // -> dungeon
+	Portals     map[string]map[string]int `json:"portals"`     // -> subrosia
+	Spheres     map[int]int               `json:"spheres"`     // total spheres
+	Depths      map[int]int               `json:"depths"`      // see seedMetrics
+}
+
+func newSeedStats(game int, master uint32) *seedStats {
+	return &seedStats{
+		Version:     version,
+		Game:        gameNames[game],
+		MasterSeed:  fmt.Sprintf("%08x", master),
+		SlotItems:   make(map[string]map[string]int),
+		ItemSpheres: make(map[string]map[int]int),
+		Reachable:   make(map[string]int),
+		Entrances:   make(map[string]map[string]int),
+		Portals:     make(map[string]map[string]int),
+		Spheres:     make(map[int]int),
+		Depths:      make(map[int]int),
+	}
+}
 
-	return routes
+// increments a count in a nested map, creating the inner map if needed.
+func addPair(m map[string]map[string]int, k, v string) {
+	if m[k] == nil {
+		m[k] = make(map[string]int)
+	}
+	m[k][v]++
 }
 
-// generate a bunch of seeds and print item configurations in YAML format.
-func logStats(game, trials int, ropts randomizerOptions, logf logFunc) {
-	// get `trials` routes
-	routes := generateSeeds(trials, game, ropts)
-
-	// make a YAML-serializable slice of check maps
-	stringChecks := make([]map[string]string, len(routes))
-	for i, ri := range routes {
-		stringChecks[i] = make(map[string]string)
-		for k, v := range getChecks(ri.usedItems, ri.usedSlots) {
-			stringChecks[i][k.name] = v.name
+// adds a seed's checks and spheres, as returned by getAllSpheres.
+func (s *seedStats) addChecks(checks map[*node]*node, spheres [][]*node) {
+	s.Seeds++
+	for slot, item := range checks {
+		addPair(s.SlotItems, slot.name, item.name)
+	}
+	for i, sphere := range spheres {
+		for _, slot := range sphere {
+			item := checks[slot]
+			if item == nil {
+				continue
+			}
+			s.Reachable[slot.name]++
+			if s.ItemSpheres[item.name] == nil {
+				s.ItemSpheres[item.name] = make(map[int]int)
+			}
+			s.ItemSpheres[item.name][i]++
 		}
-		if game == gameSeasons {
-			for area, seasonId := range ri.seasons {
-				// make sure not to overwrite info about lost woods item
-				if area == "lost woods" {
-					area = "lost woods (season)"
-				}
-				stringChecks[i][area] = seasonsById[int(seasonId)]
+	}
+	s.Spheres[len(spheres)]++
+}
+
+// adds a route's entrances and metrics.
+func (s *seedStats) addRoute(ri *routeInfo, game int,
+	treasures map[string]*treasure) {
+	g, checks, spheres, _ := getAllSpheres([]*routeInfo{ri})
+	s.addChecks(checks, spheres)
+	m := getSeedMetrics(ri, game, g, checks, spheres, treasures,
+		func() { ri.graph.reset() })
+	ri.graph["start"].removeParent(g["start"])
+	g["done"].removeParent(ri.graph["done"])
+	s.Depths[m.depth]++
+
+	for entrance, dungeon := range ri.entrances {
+		addPair(s.Entrances, entrance, dungeon)
+	}
+	for holodrum, subrosia := range ri.portals {
+		addPair(s.Portals, holodrum, subrosia)
+	}
+}
+
+// sets the fill attempt totals.
+func (s *seedStats) setAttempts(attempts, failures int) {
+	s.Attempts, s.FailedSearches = attempts, failures
+	if attempts > 0 {
+		s.FailureRate = 1 - float64(s.Seeds)/float64(attempts)
+	}
+}
+
+// returns the keys of a map with int keys, sorted.
+func orderedIntKeys(m map[int]int) []int {
+	a := make([]int, 0, len(m))
+	for k := range m {
+		a = append(a, k)
+	}
+	sort.Ints(a)
+	return a
+}
+
+// writes stats as JSON.
+func (s *seedStats) writeJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// writes stats as CSV, one row per count. the frequency is the count divided
+// by the number of seeds, except in the fill table.
+func (s *seedStats) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"table", "key", "value", "count", "frequency"})
+	row := func(table, k, v string, count int) {
+		cw.Write([]string{table, k, v, fmt.Sprint(count),
+			fmt.Sprintf("%.4f", float64(count)/float64(s.Seeds))})
+	}
+
+	cw.Write([]string{"fill", "seeds", "", fmt.Sprint(s.Seeds), ""})
+	cw.Write([]string{"fill", "attempts", "", fmt.Sprint(s.Attempts), ""})
+	cw.Write([]string{"fill", "failed searches", "",
+		fmt.Sprint(s.FailedSearches), ""})
+	cw.Write([]string{"fill", "failure rate", "", "",
+		fmt.Sprintf("%.4f", s.FailureRate)})
+
+	for _, t := range []struct {
+		name string
+		m    map[string]map[string]int
+	}{
+		{"slot item", s.SlotItems},
+		{"entrance", s.Entrances},
+		{"portal", s.Portals},
+	} {
+		for _, k := range orderedKeys(t.m) {
+			for _, v := range orderedKeys(t.m[k]) {
+				row(t.name, k, v, t.m[k][v])
 			}
 		}
-		stringChecks[i]["_seed"] = fmt.Sprintf("%08x", ri.seed)
 	}
+	for _, item := range orderedKeys(s.ItemSpheres) {
+		for _, sphere := range orderedIntKeys(s.ItemSpheres[item]) {
+			row("item sphere", item, fmt.Sprint(sphere),
+				s.ItemSpheres[item][sphere])
+		}
+	}
+	for _, slot := range orderedKeys(s.Reachable) {
+		row("reachable", slot, "", s.Reachable[slot])
+	}
+	for _, t := range []struct {
+		name string
+		m    map[int]int
+	}{
+		{"spheres", s.Spheres},
+		{"depth", s.Depths},
+	} {
+		for _, k := range orderedIntKeys(t.m) {
+			row(t.name, fmt.Sprint(k), "", t.m[k])
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
 
-	// encode to stdout
-	if err := yaml.NewEncoder(os.Stdout).Encode(stringChecks); err != nil {
-		panic(err)
+// returns the options that affect generated seeds, for checking that two sets
+// of stats are comparable: the options part of optString, plus asm includes.
+// default options are "none", so that stats from before options were recorded
+// can be told apart.
+func statsOptionString(ropts *randomizerOptions) string {
+	a := make([]string, 0)
+	if s := strings.SplitN(optString(0, ropts, "+"), "+", 2); len(s) == 2 {
+		a = append(a, s[1])
+	}
+	for _, name := range ropts.include {
+		if name != "" {
+			a = append(a, "include "+name)
+		}
+	}
+	if len(a) == 0 {
+		return "none"
+	}
+	return strings.Join(a, ", ")
+}
+
+// normalizes and checks options for stats, once before any seeds are
+// generated, so that every seed and the stats themselves use the same options.
+func checkStatsOptions(game int, ropts *randomizerOptions) error {
+	normalizeWarpOptions(ropts)
+	return checkWarpOptions(game, ropts)
+}
+
+// returns aggregated stats for n seeds.
+func getSeedStats(game, n int, master uint32,
+	ropts randomizerOptions) (*seedStats, error) {
+	if err := checkStatsOptions(game, &ropts); err != nil {
+		return nil, err
+	}
+	routes, attempts, failures, err := generateSeeds(n, game, master, ropts)
+	if err != nil {
+		return nil, err
+	}
+	treasures := newRomState(nil, game, 1, ropts.include).treasures
+	s := newSeedStats(game, master)
+	s.Options = statsOptionString(&ropts)
+	for _, ri := range routes {
+		s.addRoute(ri, game, treasures)
+	}
+	s.setAttempts(attempts, failures)
+	return s, nil
+}
+
+// generate a bunch of seeds and write aggregated stats as JSON to stdout, or
+// to a file as CSV or JSON, depending on its extension.
+func logStats(game, trials int, master uint32, ropts randomizerOptions,
+	path string) error {
+	s, err := getSeedStats(game, trials, master, ropts)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		return s.writeJSON(os.Stdout)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if strings.HasSuffix(strings.ToLower(path), ".csv") {
+		return s.writeCSV(f)
 	}
+	return s.writeJSON(f)
 }
@@ -0,0 +1,48 @@
+package randomizer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSeedStats(t *testing.T) {
+	nodes := make(map[string]*node)
+	for _, name := range []string{"chest", "cliff", "sword", "feather"} {
+		nodes[name] = newNode(name, orNode)
+	}
+	checks := map[*node]*node{
+		nodes["chest"]: nodes["sword"],
+		nodes["cliff"]: nodes["feather"],
+	}
+	spheres := [][]*node{{nodes["chest"]}, {nodes["cliff"]}}
+
+	s := newSeedStats(gameSeasons, 0x1234abcd)
+	s.addChecks(checks, spheres)
+	s.addChecks(checks, spheres[:1])
+	s.setAttempts(4, 0)
+
+	testExpect(t, s.Seeds, 2)
+	testExpect(t, s.SlotItems["cliff"], map[string]int{"feather": 2})
+	testExpect(t, s.ItemSpheres["sword"], map[int]int{0: 2})
+	testExpect(t, s.ItemSpheres["feather"], map[int]int{1: 1})
+	testExpect(t, s.Reachable, map[string]int{"chest": 2, "cliff": 1})
+	testExpect(t, s.Spheres, map[int]int{1: 1, 2: 1})
+	testExpect(t, s.FailureRate, 0.5)
+
+	b := new(bytes.Buffer)
+	testExpect(t, s.writeCSV(b), nil)
+	lines := strings.Split(b.String(), "\n")
+	testExpect(t, lines[0], "table,key,value,count,frequency")
+	testExpect(t, sliceContains(lines, "slot item,chest,sword,2,1.0000"),
+		true)
+	testExpect(t, sliceContains(lines, "item sphere,feather,1,1,0.5000"),
+		true)
+	testExpect(t, sliceContains(lines, "fill,failure rate,,,0.5000"), true)
+
+	ropts := &randomizerOptions{mixwarps: true}
+	testExpect(t, checkStatsOptions(gameSeasons, ropts), nil)
+	testExpect(t, ropts.dungeons && ropts.portals, true)
+	_, err := getSeedStats(gameAges, 1, 0, randomizerOptions{mixwarps: true})
+	testExpect(t, err != nil, true)
+}
@@ -1,27 +1,24 @@
 package randomizer
 
 import (
+	"encoding/csv"
 	"fmt"
+	"io"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
-// returns a channel that will write strings to a text file with CRLF line
-// endings. the function will send on the int channel when finished printing.
-func getSummaryChannel(filename string) (chan string, chan int) {
+// returns a channel that will write strings to w with CRLF line endings. the
+// function will send on the int channel when finished printing.
+func getSummaryChannel(w io.Writer) (chan string, chan int) {
 	c, done := make(chan string), make(chan int)
 
 	go func() {
-		logFile, err := os.Create(filename)
-		if err != nil {
-			panic(err)
-		}
-		defer logFile.Close()
-
 		for line := range c {
-			fmt.Fprintf(logFile, "%s\r\n", line)
+			fmt.Fprintf(w, "%s\r\n", line)
 		}
 		done <- 1
 	}()
@@ -156,15 +153,39 @@ func spheresToText(spheres [][]*node, checks map[*node]*node, except *node) stri
 }
 
 // write a "spoiler log" to a file.
-func writeSummary(path string, checksum []byte, ropts randomizerOptions,
-	rom *romState, ri *routeInfo, checks map[*node]*node, spheres [][]*node,
-	extra []*node, g graph, resetFunc func(), treasures map[string]*treasure,
-	owlHints map[string]string) {
-	summary, summaryDone := getSummaryChannel(path)
+func writeSummary(w io.Writer, checksum []byte, ropts randomizerOptions,
+	rom *romState, ri *routeInfo, games []int, checks map[*node]*node,
+	spheres [][]*node, extra []*node, g graph, resetFunc func(),
+	treasures map[string]*treasure, owlHints map[string]string) {
+	summary, summaryDone := getSummaryChannel(w)
+
+	// multiworld logs only include checks in the player's own world and the
+	// player's own items in other worlds.
+	multi := false
+	for slot := range checks {
+		multi = slot.player != 0
+		break
+	}
+	if multi {
+		playerChecks := make(map[*node]*node)
+		for slot, item := range checks {
+			if slot.player == rom.player || item.player == rom.player {
+				playerChecks[slot] = item
+			}
+		}
+		checks = playerChecks
+	}
 
 	// header
 	summary <- fmt.Sprintf("seed: %08x", ri.seed)
+	if multi {
+		summary <- fmt.Sprintf("player: %d", rom.player)
+	}
 	summary <- fmt.Sprintf("sha-1 sum: %x", checksum)
+	if rom.icons != nil {
+		summary <- fmt.Sprintf("hash icons: %s",
+			strings.Join(getHashIconNames(rom.icons), ", "))
+	}
 	summary <- fmt.Sprintf("difficulty: %s",
 		ternary(ropts.hard, "hard", "normal"))
 
@@ -177,14 +198,26 @@ func writeSummary(path string, checksum []byte, ropts randomizerOptions,
 	}
 	prog, junk := filterJunk(g, nonKeyChecks, treasures, resetFunc)
 	sendSectionHeader(summary, "progression items")
-	logSpheres(summary, prog, spheres, extra, rom.game, nil)
+	logSpheres(summary, prog, spheres, extra, games, nil)
 	sendSectionHeader(summary, "small keys and boss keys")
-	logSpheres(summary, checks, spheres, extra, rom.game, keyRegexp.MatchString)
+	logSpheres(summary, checks, spheres, extra, games, keyRegexp.MatchString)
 	sendSectionHeader(summary, "other items")
-	logSpheres(summary, junk, spheres, extra, rom.game, nil)
+	logSpheres(summary, junk, spheres, extra, games, nil)
 
 	// warps
-	if ropts.dungeons {
+	if ropts.mixwarps {
+		sendSectionHeader(summary, "dungeons and portals")
+		sendSorted(summary, func(c chan string) {
+			for entrance, dest := range ri.entrances {
+				if !strings.HasSuffix(entrance, " portal") {
+					entrance += " entrance"
+				}
+				c <- fmt.Sprintf("%-28s <- %s", getNiceName(entrance, rom.game),
+					getNiceName(dest, rom.game))
+			}
+			close(c)
+		})
+	} else if ropts.dungeons {
 		sendSectionHeader(summary, "dungeon entrances")
 		sendSorted(summary, func(c chan string) {
 			for entrance, dungeon := range ri.entrances {
@@ -194,7 +227,7 @@ func writeSummary(path string, checksum []byte, ropts randomizerOptions,
 			close(c)
 		})
 	}
-	if ropts.portals {
+	if ropts.portals && !ropts.mixwarps {
 		sendSectionHeader(summary, "subrosia portals")
 		sendSorted(summary, func(c chan string) {
 			for in, out := range ri.portals {
@@ -203,6 +236,54 @@ func writeSummary(path string, checksum []byte, ropts randomizerOptions,
 			}
 			close(c)
 		})
+		if ropts.decouple {
+			sendSectionHeader(summary, "subrosia portal exits")
+			sendSorted(summary, func(c chan string) {
+				for in, out := range ri.portalExits {
+					c <- fmt.Sprintf("%-20s <- %s",
+						getNiceName(in, rom.game), getNiceName(out, rom.game))
+				}
+				close(c)
+			})
+		}
+	}
+
+	if len(ri.startItems) > 0 {
+		sendSectionHeader(summary, "starting items")
+		for _, item := range ri.startItems {
+			summary <- fmt.Sprintf("start <- %s", getNiceName(item, rom.game))
+		}
+	}
+	if ropts.companion != 0 {
+		sendSectionHeader(summary, "animal companion")
+		summary <- fmt.Sprintf("companion <- %s", companionNames[ri.companion])
+	}
+
+	// multiworld rules
+	if ropts.multi.any() {
+		sendSectionHeader(summary, "multiworld rules")
+		if len(ropts.multi.local) > 0 {
+			summary <- fmt.Sprintf("local      <- %s",
+				strings.Join(ropts.multi.local, ", "))
+		}
+		if len(ropts.multi.remote) > 0 {
+			summary <- fmt.Sprintf("remote     <- %s",
+				strings.Join(ropts.multi.remote, ", "))
+		}
+		if len(ropts.multi.noDungeons) > 0 {
+			players := make([]string, len(ropts.multi.noDungeons))
+			for i, player := range ropts.multi.noDungeons {
+				players[i] = fmt.Sprintf("P%d", player)
+			}
+			summary <- fmt.Sprintf("nodungeons <- %s",
+				strings.Join(players, ", "))
+		}
+		if ropts.multi.rings {
+			summary <- "rings      <- eligible"
+		}
+		if ropts.multi.shops {
+			summary <- "shops      <- eligible"
+		}
 	}
 
 	// default seasons (oos only)
@@ -229,6 +310,19 @@ func writeSummary(path string, checksum []byte, ropts randomizerOptions,
 		})
 	}
 
+	// playthrough and metrics aren't meaningful for a single world of a
+	// multiworld seed
+	if !multi {
+		m := getSeedMetrics(ri, rom.game, g, checks, spheres, treasures,
+			resetFunc)
+		logPlaythrough(summary, g, checks, spheres, ri, rom.game,
+			m.hardTricks, resetFunc)
+		sendSectionHeader(summary, "metrics")
+		for _, line := range m.lines() {
+			summary <- line
+		}
+	}
+
 	close(summary)
 	<-summaryDone
 }
@@ -257,3 +351,105 @@ func sendSectionHeader(c chan string, name string) {
 	c <- fmt.Sprintf("-- %s --", name)
 	c <- ""
 }
+
+// writes the combined multiworld playthrough: the progression items of all
+// players, in the order they can be found.
+func writeMultiPlaythrough(path string, seed uint32, games []int,
+	checks map[*node]*node, spheres [][]*node, extra []*node, g graph,
+	resetFunc func(), treasures map[string]*treasure) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	summary, summaryDone := getSummaryChannel(f)
+
+	summary <- fmt.Sprintf("seed: %08x", seed)
+	summary <- fmt.Sprintf("players: %d", len(games))
+
+	nonKeyChecks := make(map[*node]*node)
+	for slot, item := range checks {
+		if !keyRegexp.MatchString(item.name) {
+			nonKeyChecks[slot] = item
+		}
+	}
+	prog, _ := filterJunk(g, nonKeyChecks, treasures, resetFunc)
+	sendSectionHeader(summary, "multiworld playthrough")
+	logSpheres(summary, prog, spheres, extra, games, nil)
+
+	close(summary)
+	<-summaryDone
+	return nil
+}
+
+// writes a CSV of all items that are found in one player's world and sent to
+// another, in sphere order.
+func writeItemLedger(path string, games []int, checks map[*node]*node,
+	spheres [][]*node) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"sphere", "finder", "location", "owner", "item"})
+	for _, record := range getItemLedger(games, checks, spheres) {
+		w.Write(record)
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// returns the records for writeItemLedger. checks not in any sphere are
+// listed last, with "inaccessible" as their sphere.
+func getItemLedger(games []int, checks map[*node]*node,
+	spheres [][]*node) [][]string {
+	sphereIndex := make(map[*node]int)
+	for i, sphere := range spheres {
+		for _, n := range sphere {
+			sphereIndex[n] = i
+		}
+	}
+
+	records := make([][]string, 0)
+	for slot, item := range checks {
+		if slot.player == item.player {
+			continue
+		}
+		sphere := "inaccessible"
+		if i, ok := sphereIndex[slot]; ok {
+			sphere = strconv.Itoa(i)
+		}
+		records = append(records, []string{
+			sphere,
+			fmt.Sprintf("P%d", slot.player),
+			getNiceName(slot.name, games[slot.player-1]),
+			fmt.Sprintf("P%d", item.player),
+			getNiceName(item.name, games[item.player-1]),
+		})
+	}
+
+	// sort by sphere, then finder, then location
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a[0] != b[0] {
+			ai, aErr := strconv.Atoi(a[0])
+			bi, bErr := strconv.Atoi(b[0])
+			if aErr != nil || bErr != nil {
+				return aErr == nil
+			}
+			return ai < bi
+		}
+		if a[1] != b[1] {
+			// "P10" goes after "P9"
+			if len(a[1]) != len(b[1]) {
+				return len(a[1]) < len(b[1])
+			}
+			return a[1] < b[1]
+		}
+		return a[2] < b[2]
+	})
+
+	return records
+}
@@ -0,0 +1,32 @@
+package randomizer
+
+import (
+	"testing"
+)
+
+func TestItemLedger(t *testing.T) {
+	newCheck := func(slotName string, slotPlayer int, itemName string,
+		itemPlayer int) (*node, *node) {
+		slot, item := newNode(slotName, andNode), newNode(itemName, orNode)
+		slot.player, item.player = slotPlayer, itemPlayer
+		return slot, item
+	}
+
+	checks := make(map[*node]*node)
+	s1, i1 := newCheck("maku tree", 1, "switch hook", 2)
+	s2, i2 := newCheck("maku tree", 2, "sword", 1)
+	s3, i3 := newCheck("horon village SW chest", 1, "feather", 1)
+	s4, i4 := newCheck("d1 basement", 1, "harp", 2)
+	for _, pair := range [][2]*node{{s1, i1}, {s2, i2}, {s3, i3}, {s4, i4}} {
+		checks[pair[0]] = pair[1]
+	}
+	spheres := [][]*node{{s2, i2, s3, i3}, {s1, i1}}
+
+	records := getItemLedger(
+		[]int{gameSeasons, gameAges}, checks, spheres)
+	testExpect(t, len(records), 3)
+	testExpect(t, records[0][:2], []string{"0", "P2"})
+	testExpect(t, records[0][3], "P1")
+	testExpect(t, records[1][:2], []string{"1", "P1"})
+	testExpect(t, records[2][0], "inaccessible")
+}
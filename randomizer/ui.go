@@ -39,6 +39,7 @@ const (
 	modeWorking uiMode = iota
 	modePrompt
 	modeDone
+	modeForm
 )
 
 var uiBottom = []uiSegment{
@@ -46,6 +47,25 @@ var uiBottom = []uiSegment{
 	{text: "uit"},
 }
 
+var uiFormBottom = []uiSegment{
+	{text: "(up/down)", style: tcell.StyleDefault.Bold(true)},
+	{text: " move  "},
+	{text: "(space)", style: tcell.StyleDefault.Bold(true)},
+	{text: " change  "},
+	{text: "(enter)", style: tcell.StyleDefault.Bold(true)},
+	{text: " edit  "},
+	{text: "(g)", style: tcell.StyleDefault.Bold(true)},
+	{text: "enerate  "},
+	{text: "(q)", style: tcell.StyleDefault.Bold(true)},
+	{text: "uit"},
+}
+
+// the lines of a form, and the line that should be kept onscreen.
+type uiForm struct {
+	lines  []uiLine
+	cursor int
+}
+
 type uiInstance struct {
 	// this one's actually used as a constant, but can't be declared as one
 	lines          []uiLine
@@ -54,6 +74,9 @@ type uiInstance struct {
 	input, prompt  chan rune
 	resize         chan interface{}
 	change         chan uiMode
+	form           uiForm
+	setForm        chan uiForm
+	quit           chan bool
 }
 
 // creates and displays a blank TUI.
@@ -77,6 +100,8 @@ func newUI(title string) *uiInstance {
 		prompt:  make(chan rune),           // key input passed from main to prompt
 		resize:  make(chan interface{}, 1), // send to update window size
 		change:  make(chan uiMode, 1),      // change uiMode
+		setForm: make(chan uiForm),         // replace form lines
+		quit:    make(chan bool),           // close TUI
 	}
 
 	ui.draw(modeWorking)
@@ -93,7 +118,10 @@ func (ui *uiInstance) run() {
 			switch evt := ui.screen.PollEvent().(type) {
 			case *tcell.EventKey:
 				switch evt.Key() {
-				case tcell.KeyCtrlC, tcell.KeyDEL: // del is backspace
+				case tcell.KeyCtrlC, tcell.KeyDEL, // del is backspace
+					tcell.KeyBackspace, tcell.KeyEnter, tcell.KeyTab,
+					tcell.KeyEscape, tcell.KeyUp, tcell.KeyDown,
+					tcell.KeyLeft, tcell.KeyRight:
 					ui.input <- rune(evt.Key())
 				case tcell.KeyRune:
 					ui.input <- evt.Rune()
@@ -116,12 +144,19 @@ func (ui *uiInstance) run() {
 			ui.lines[len(ui.lines)-1] = ln
 			ui.draw(mode)
 		case ch := <-ui.input:
-			if ch == 'q' || ch == rune(tcell.KeyCtrlC) || mode == modeDone {
+			if ch == rune(tcell.KeyCtrlC) || mode == modeDone ||
+				(ch == 'q' && mode != modeForm) {
 				ui.screen.Fini()
 				loop = false
-			} else if mode == modePrompt {
+			} else if mode == modePrompt || mode == modeForm {
 				ui.prompt <- ch
 			}
+		case f := <-ui.setForm:
+			ui.form = f
+			ui.draw(mode)
+		case <-ui.quit:
+			ui.screen.Fini()
+			loop = false
 		case <-ui.resize:
 			ui.screen.Sync()
 			ui.draw(mode)
@@ -146,18 +181,31 @@ func (ui *uiInstance) draw(mode uiMode) {
 
 	// draw content lines
 	scroll := 0
-	if len(ui.lines) > h-3 {
-		scroll = len(ui.lines) - (h - 3)
-	}
-	for i, ln := range ui.lines[scroll+1:] {
-		x = ui.drawLine(w, i+2, ln)
+	if mode == modeForm {
+		// keep the cursor onscreen
+		if ui.form.cursor >= h-4 {
+			scroll = ui.form.cursor - (h - 5)
+		}
+		for i, ln := range ui.form.lines[scroll:] {
+			if i+2 < h-2 {
+				ui.drawLine(w, i+2, ln)
+			}
+		}
+	} else {
+		if len(ui.lines) > h-3 {
+			scroll = len(ui.lines) - (h - 3)
+		}
+		for i, ln := range ui.lines[scroll+1:] {
+			x = ui.drawLine(w, i+2, ln)
+		}
 	}
 
 	// draw bottom bar
 	for x := 0; x < w; x++ {
 		ui.screen.SetContent(x, h-2, '─', nil, tcell.StyleDefault)
 	}
-	ui.drawLine(w, h-1, uiBottom)
+	ui.drawLine(w, h-1, ternary(mode == modeForm,
+		uiFormBottom, uiBottom).([]uiSegment))
 
 	// draw cursor if applicable
 	if mode == modePrompt {
@@ -297,29 +345,6 @@ func (ui *uiInstance) doPrompt(s string) rune {
 	}
 }
 
-// waits for the user to input 8 hex digits, then returns the string.
-func (ui *uiInstance) promptSeed(s string) string {
-	acceptedRunes := "0123456789abcdef"
-	line := []uiSegment{{text: s + " "}, {text: ""}}
-
-	ui.write <- line
-	ui.change <- modePrompt
-	for {
-		ch := <-ui.prompt
-		if strings.ContainsRune(acceptedRunes, ch) {
-			line[1].text += string(ch)
-		} else if ch == rune(tcell.KeyDEL) && len(line[1].text) > 0 {
-			line[1].text = line[1].text[:len(line[1].text)-1]
-		}
-		ui.rewrite <- line
-
-		if len(line[1].text) == 8 {
-			ui.change <- modeWorking
-			return line[1].text
-		}
-	}
-}
-
 // changes the mode to one where no action is taken, and any input closes the
 // program.
 func (ui *uiInstance) done() {